@@ -0,0 +1,432 @@
+package collab
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements multi-user editing sessions over TCP or a Unix socket.  The host
+owns the permascroll and each other participant joins the session and mirrors
+it.  Participants exchange newline terminated messages, each starting with a
+single letter:
+
+	H<participant>                          host to participant: hello, with participant number
+	R<participant> <version> <record>       host to participant: record appended to the permascroll
+	G<version>                              host to participant: go to version, after the initial records
+	O<version> <parent> <milliseconds> <op> participant to host: operation performed
+
+The host is participant 0.  The parent of an operation is prefixed with "~" if
+it is a provisional version of the participant that the host has not yet
+confirmed, in which case the host substitutes the version that confirmed it.
+
+Messages are received on separate goroutines and delivered as events, which
+must be handled on the goroutine that edits the permascroll.
+*/
+
+const (
+	eventBuffer = 64  // Number of received messages that can be queued
+	sendBuffer  = 256 // Number of outgoing messages that can be queued per participant
+)
+
+var (
+	ErrDisconnected = errors.New("disconnected from the session")
+	errMessage      = errors.New("invalid message")
+	errOverflow     = errors.New("too many messages queued for the host")
+)
+
+// A message received from another participant, or a change in the
+// participants of the session.
+type Event struct {
+	peer   *peer  // Participant the event concerns, for a host
+	line   string // Message received, if any
+	joined bool   // The participant joined the session
+	err    error  // The connection failed or was closed
+}
+
+// The result of handling an event.
+type Update struct {
+	Version     int   // Version created or adopted, or -1 if none
+	Participant int   // Participant whose operation created the version
+	Remote      bool  // The version was created by another participant
+	Changed     bool  // The current version of the document changed
+	Err         error // Error to report, if any
+}
+
+// A multi-user editing session.
+type Session interface {
+	Close() error              // Leave the session
+	Events() <-chan Event      // Events to be handled
+	Handle(e Event) (u Update) // Handle an event on the goroutine that edits the permascroll
+	Participant() int          // Number of this participant
+}
+
+// A connection to another participant.
+type peer struct {
+	id       int
+	conn     net.Conn
+	out      chan string
+	versions map[int]int // Host version confirming each provisional version of the participant
+}
+
+// Host of a session.
+type Host struct {
+	ps       *ps.Permascroll
+	listener net.Listener
+	events   chan Event
+	mutex    sync.Mutex    // Guards peers, which are also used by the observer of the permascroll
+	peers    map[int]*peer // Participants that have joined
+	origin   int           // Participant whose operation is being applied
+	created  bool          // The operation being applied created a version
+}
+
+// Participant that joined a session.
+type Client struct {
+	ps       *ps.Permascroll
+	conn     net.Conn
+	events   chan Event
+	out      chan string
+	sent     chan struct{} // Closed when every queued message has been sent
+	overflow bool          // The queue of messages for the host overflowed
+	id       int
+}
+
+// The network and address for a session address, which is either a TCP host
+// and port or "unix:" followed by the path of a Unix socket.
+func parseAddress(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return "unix", path
+	}
+
+	return "tcp", address
+}
+
+// Deliver each message received on a connection as an event, followed by an
+// event reporting the error that ended the connection.
+func receive(conn net.Conn, p *peer, events chan<- Event) {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			events <- Event{peer: p, err: fmt.Errorf("%w: %w", ErrDisconnected, err)}
+
+			return
+		}
+
+		events <- Event{peer: p, line: line}
+	}
+}
+
+// Write each queued message to a connection until the queue is closed.
+func transmit(conn net.Conn, out <-chan string) {
+	for s := range out {
+		if _, err := conn.Write([]byte(s)); err != nil {
+			conn.Close() // ignore error; the receiver reports the failure
+
+			return
+		}
+	}
+}
+
+// Host a session on address, sharing the permascroll with the participants
+// that join it.
+func Listen(p *ps.Permascroll, address string) (h *Host, err error) {
+	network, addr := parseAddress(address)
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to host session: %w", err)
+	}
+
+	h = &Host{ps: p, listener: listener, events: make(chan Event, eventBuffer), peers: make(map[int]*peer)}
+	p.Observe(h.broadcast)
+	go h.accept()
+
+	return h, nil
+}
+
+// Accept participants until the listener is closed.
+func (h *Host) accept() {
+	for id := 1; ; id++ {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		p := &peer{id: id, conn: conn, out: make(chan string, sendBuffer), versions: make(map[int]int)}
+		go transmit(conn, p.out)
+		h.events <- Event{peer: p, joined: true}
+		go receive(conn, p, h.events)
+	}
+}
+
+// The address that the host is listening on.
+func (h *Host) Addr() net.Addr { return h.listener.Addr() }
+
+// Queue a message for a participant without blocking.  A participant whose
+// queue is full is not keeping up with the session, so it is disconnected and
+// leaves when the failure is received.
+func (p *peer) queue(s string) {
+	select {
+	case p.out <- s:
+	default:
+		p.conn.Close() // ignore error; the receiver reports the failure
+	}
+}
+
+// Send a record appended to the permascroll to every participant.
+func (h *Host) broadcast(op ps.Operation) {
+	h.created = true
+	h.mutex.Lock()
+	peers := slices.Collect(maps.Values(h.peers))
+	h.mutex.Unlock()
+
+	s := fmt.Sprintf("R%d %d %s", h.origin, op.Version, op.Record)
+	for _, p := range peers {
+		p.queue(s)
+	}
+}
+
+// Stop hosting the session and disconnect the participants.
+func (h *Host) Close() error {
+	h.ps.Observe(nil)
+	err := h.listener.Close()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for id, p := range h.peers {
+		close(p.out)
+		p.conn.Close() // ignore error; the listener error takes precedence
+		delete(h.peers, id)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to close session: %w", err)
+	}
+
+	return err
+}
+
+func (h *Host) Events() <-chan Event { return h.events }
+
+func (h *Host) Handle(e Event) (u Update) {
+	u.Version = -1
+	switch {
+	case e.joined:
+		h.join(e.peer)
+	case e.err != nil:
+		h.leave(e.peer)
+	default:
+		u = h.apply(e.peer, e.line)
+	}
+
+	return u
+}
+
+// Add a participant to the session and send it the permascroll.
+func (h *Host) join(p *peer) {
+	var s strings.Builder
+	fmt.Fprintf(&s, "H%d\n", p.id)
+	for v, r := range h.ps.Records() {
+		fmt.Fprintf(&s, "R0 %d %s", v, r)
+	}
+	fmt.Fprintf(&s, "G%d\n", h.ps.CurrentVersion())
+
+	h.mutex.Lock()
+	h.peers[p.id] = p
+	h.mutex.Unlock()
+	p.queue(s.String())
+}
+
+// Remove a participant from the session.
+func (h *Host) leave(p *peer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.peers[p.id]; ok {
+		close(p.out)
+		p.conn.Close() // ignore error; the connection has already failed
+		delete(h.peers, p.id)
+	}
+}
+
+// Apply an operation performed by a participant.
+func (h *Host) apply(p *peer, line string) (u Update) {
+	u.Version = -1
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 4)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "O") {
+		u.Err = fmt.Errorf("participant %d sent %q: %w", p.id, line, errMessage)
+
+		return u
+	}
+
+	version, err := strconv.Atoi(fields[0][1:])
+	parent, provisional := strings.CutPrefix(fields[1], "~")
+	pv, perr := strconv.Atoi(parent)
+	ms, terr := strconv.ParseInt(fields[2], 10, 64)
+	if err = errors.Join(err, perr, terr); err != nil {
+		u.Err = fmt.Errorf("participant %d sent %q: %w: %w", p.id, line, errMessage, err)
+
+		return u
+	}
+
+	if provisional {
+		var ok bool
+		if pv, ok = p.versions[pv]; !ok {
+			u.Err = fmt.Errorf("participant %d sent %q: unknown version: %w", p.id, line, errMessage)
+
+			return u
+		}
+	}
+
+	h.origin, h.created = p.id, false
+	v, err := h.ps.ApplyOperation(pv, time.UnixMilli(ms), fields[3])
+	h.origin = 0
+	if err != nil {
+		u.Err = fmt.Errorf("participant %d: %w", p.id, err)
+
+		return u
+	}
+
+	p.versions[version] = v
+	if !h.created {
+		// The operation revisited an existing version, so no record was sent
+		p.queue(fmt.Sprintf("G%d\n", v))
+	}
+
+	return Update{Version: v, Participant: p.id, Remote: h.created}
+}
+
+func (h *Host) Participant() int { return 0 }
+
+// Join the session hosted at address, replacing the permascroll with a mirror
+// of the permascroll of the host.
+func Dial(p *ps.Permascroll, address string) (c *Client, err error) {
+	network, addr := parseAddress(address)
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join session: %w", err)
+	}
+
+	c = &Client{ps: p, conn: conn, events: make(chan Event, eventBuffer), out: make(chan string, sendBuffer),
+		sent: make(chan struct{}), id: -1}
+	p.OpenMirror()
+	p.Observe(c.send)
+	go func() {
+		transmit(conn, c.out)
+		close(c.sent)
+	}()
+	go receive(conn, nil, c.events)
+
+	return c, nil
+}
+
+// Send an operation performed by this participant to the host.
+func (c *Client) send(op ps.Operation) {
+	parent := strconv.Itoa(op.Parent)
+	if c.ps.Provisional(op.Parent) {
+		parent = "~" + parent
+	}
+
+	c.queue(fmt.Sprintf("O%d %s %d %s\n", op.Version, parent, op.Time.UnixMilli(), op.Body))
+}
+
+// Queue a message for the host without blocking.  A host that is not keeping
+// up with the session is disconnected like a slow participant, and the overflow
+// is reported when the failure is received.
+func (c *Client) queue(s string) {
+	select {
+	case c.out <- s:
+	default:
+		c.overflow = true
+		c.conn.Close() // ignore error; the receiver reports the failure
+	}
+}
+
+// Leave the session.
+func (c *Client) Close() error {
+	c.ps.Observe(nil)
+	close(c.out)
+	<-c.sent
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("failed to close session: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) Events() <-chan Event { return c.events }
+
+func (c *Client) Handle(e Event) (u Update) {
+	u.Version = -1
+	if e.err != nil {
+		u.Err = e.err
+		if c.overflow {
+			u.Err = fmt.Errorf("%w: %w", errOverflow, e.err)
+		}
+
+		return u
+	}
+
+	line := strings.TrimSuffix(e.line, "\n")
+	current := c.ps.CurrentVersion()
+	switch {
+	case strings.HasPrefix(line, "H"):
+		c.id, u.Err = strconv.Atoi(line[1:])
+	case strings.HasPrefix(line, "G"):
+		if v, err := strconv.Atoi(line[1:]); err == nil && v >= 0 && v < c.ps.Versions() {
+			u.Version = v
+			c.ps.GotoVersion(v)
+		} else {
+			u.Err = errMessage
+		}
+	case strings.HasPrefix(line, "R"):
+		u = c.mirror(e.line)
+	default:
+		u.Err = errMessage
+	}
+
+	if u.Err != nil {
+		u.Err = fmt.Errorf("host sent %q: %w", e.line, u.Err)
+	}
+
+	u.Changed = c.ps.CurrentVersion() != current
+
+	return u
+}
+
+// Mirror a record appended to the permascroll of the host.
+func (c *Client) mirror(line string) (u Update) {
+	u.Version = -1
+	fields := strings.SplitN(line[1:], " ", 3)
+	if len(fields) < 3 {
+		u.Err = errMessage
+
+		return u
+	}
+
+	if u.Participant, u.Err = strconv.Atoi(fields[0]); u.Err != nil {
+		return u
+	}
+
+	if u.Version, u.Err = c.ps.MirrorRecord(fields[2]); u.Err != nil {
+		return u
+	}
+
+	u.Remote = u.Participant != c.id
+	if !u.Remote && !c.ps.Provisional(c.ps.CurrentVersion()) {
+		// Adopt the version created by this participant if it was rebased
+		c.ps.GotoVersion(u.Version)
+	}
+
+	return u
+}
+
+func (c *Client) Participant() int { return c.id }
@@ -0,0 +1,137 @@
+package collab
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+// Handle the next event of a session.
+func next(t *testing.T, s Session) Update {
+	t.Helper()
+	select {
+	case e := <-s.Events():
+		return s.Handle(e)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for event")
+	}
+
+	return Update{}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := map[string]struct{ address, network, addr string }{
+		"TCP":  {"localhost:7707", "tcp", "localhost:7707"},
+		"Unix": {"unix:/tmp/jotty.sock", "unix", "/tmp/jotty.sock"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			network, addr := parseAddress(tc.address)
+			assert.Equal(t, tc.network, network)
+			assert.Equal(t, tc.addr, addr)
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	host := ps.New("")
+	require.NoError(t, host.OpenPermascroll(filepath.Join(dir, "host.jot")))
+	defer host.ClosePermascroll()
+	host.AppendText(1, "One")
+	host.Flush()
+
+	address := "unix:" + filepath.Join(dir, "socket")
+	h, err := Listen(host, address)
+	require.NoError(t, err)
+	defer h.Close()
+	assert.Zero(h.Participant())
+
+	mirror := ps.New("")
+	c, err := Dial(mirror, address)
+	require.NoError(t, err)
+	assert.Equal(Update{Version: -1}, next(t, h), "joined")
+
+	next(t, c) // Hello
+	assert.Equal(1, c.Participant())
+	assert.Equal(Update{Version: 0, Remote: true}, next(t, c))
+	assert.Equal(Update{Version: 1, Remote: true}, next(t, c))
+	assert.Equal(Update{Version: 1, Changed: true}, next(t, c), "go to current version")
+	assert.Equal("One", mirror.GetText(1))
+
+	// An operation of the participant creates a version on the host
+	mirror.AppendText(1, " two")
+	mirror.Flush()
+	assert.True(mirror.Provisional(2))
+	assert.Equal(Update{Version: 2, Participant: 1, Remote: true}, next(t, h))
+	assert.Equal(1, host.CurrentVersion(), "current version retained")
+	assert.Equal(Update{Version: 2, Participant: 1}, next(t, c), "confirmed")
+	assert.False(mirror.Provisional(2))
+
+	// An operation of the host is mirrored without changing the current version
+	host.AppendText(1, " three")
+	host.Flush()
+	assert.Equal(Update{Version: 3, Remote: true}, next(t, c))
+	assert.Equal(2, mirror.CurrentVersion())
+	assert.Equal("One two", mirror.GetText(1))
+	mirror.GotoVersion(3)
+	assert.Equal("One three", mirror.GetText(1))
+
+	require.NoError(t, c.Close())
+	assert.Equal(Update{Version: -1}, next(t, h), "left")
+	assert.Empty(h.peers)
+}
+
+func TestSlowPeer(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer remote.Close()
+	p := &peer{id: 1, conn: conn, out: make(chan string, 1), versions: make(map[int]int)}
+	h := &Host{peers: map[int]*peer{1: p}}
+
+	h.broadcast(ps.Operation{Version: 1, Record: "I1,0:A\n"})
+	assert.Equal(t, "R0 1 I1,0:A\n", <-p.out)
+
+	// A participant whose queue is full is disconnected rather than blocking
+	h.broadcast(ps.Operation{Version: 2, Record: "I1,1:B\n"})
+	h.broadcast(ps.Operation{Version: 3, Record: "I1,2:C\n"})
+	_, err := remote.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSlowHost(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer remote.Close()
+	c := &Client{ps: ps.New(""), conn: conn, events: make(chan Event, 1), out: make(chan string, 1)}
+	go receive(conn, nil, c.events)
+
+	c.send(ps.Operation{Version: 1, Time: time.UnixMilli(1), Body: "I1,0:A"})
+	assert.Equal(t, "O1 0 1 I1,0:A\n", <-c.out)
+
+	// The host is disconnected rather than blocking when the queue is full
+	c.send(ps.Operation{Version: 2, Parent: 1, Body: "I1,1:B"})
+	c.send(ps.Operation{Version: 3, Parent: 2, Body: "I1,2:C"})
+	u := next(t, c)
+	require.ErrorIs(t, u.Err, errOverflow)
+	require.ErrorIs(t, u.Err, ErrDisconnected)
+}
+
+func TestClientGoto(t *testing.T) {
+	mirror := ps.New("I1,0:One\n")
+	c := &Client{ps: mirror, id: 1}
+	assert.Equal(t, Update{Version: 0, Changed: true}, c.Handle(Event{line: "G0\n"}))
+
+	for _, line := range []string{"G2\n", "G-1\n", "Gx\n"} {
+		u := c.Handle(Event{line: line})
+		assert.Equal(t, -1, u.Version)
+		require.ErrorIs(t, u.Err, errMessage)
+	}
+	assert.Zero(t, mirror.CurrentVersion())
+}
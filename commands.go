@@ -0,0 +1,423 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xanni/jotty/i18n"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+// The permascroll path for a command that takes at most one filename, or false
+// if there are more arguments.
+func commandPath(args []string) (path string, ok bool) {
+	switch len(args) {
+	case 0:
+		return defaultPermascroll, true
+	case 1:
+		return args[0], true
+	}
+
+	flag.Usage()
+
+	return "", false
+}
+
+// Append paragraphs read from standard input to a permascroll.  Returns the exit
+// status.
+func appendText(args []string) int {
+	path, ok := commandPath(args)
+	if !ok {
+		return 2
+	}
+
+	text, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	p := ps.New("")
+	if err = p.OpenPermascroll(path); errors.Is(err, ps.ErrRecovered) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	err = p.AppendParagraphs(string(text))
+	if cerr := p.ClosePermascroll(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// Print the current version of a permascroll in the selected export format.
+// Returns the exit status.
+func cat(args []string, format string) int {
+	path, ok := commandPath(args)
+	if !ok {
+		return 2
+	}
+
+	p, err := openReadOnly(path)
+	if err == nil {
+		err = p.SetExportFormat(format)
+	}
+
+	if err == nil {
+		err = p.WriteText(os.Stdout)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// Verify permascrolls and report on their contents.  Returns the exit status.
+func fsck(paths []string) (status int) {
+	if len(paths) == 0 {
+		paths = []string{defaultPermascroll}
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			status = 1
+
+			continue
+		}
+
+		r := ps.Check(data)
+		for _, p := range r.Problems {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, p)
+			status = 1
+		}
+
+		fmt.Printf(i18n.Text["fsck"]+"\n", path, r.Operations, r.Versions, r.Branches, r.Cuts)
+	}
+
+	return status
+}
+
+// Layouts accepted for the time of a version to export, in local time unless
+// the offset from UTC is given.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// Parse a time in one of the accepted layouts.
+func parseTime(s string) (t time.Time, err error) {
+	for _, layout := range timeLayouts {
+		if t, err = time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return t, fmt.Errorf("invalid time %q: %w", s, err)
+}
+
+// Export the document at a version, or if version is negative at the version
+// created most recently by the time at, without opening the editor or changing
+// the permascroll.  Only one of version and at may be given.  Returns the exit
+// status.
+func exportAt(path, exportPath, format string, version int, at string) int {
+	if version >= 0 && at != "" {
+		fmt.Fprintln(os.Stderr, i18n.Text["at-both"])
+
+		return 2
+	}
+
+	p, err := openReadOnly(path)
+	if err == nil {
+		err = p.SetExportFormat(format)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	if version < 0 {
+		t, err := parseTime(at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+
+			return 2
+		}
+
+		if version = p.VersionAt(t); version < 0 {
+			fmt.Fprintf(os.Stderr, i18n.Text["no_version"]+"\n", path, at)
+
+			return 1
+		}
+	}
+
+	if version >= p.Versions() {
+		fmt.Fprintf(os.Stderr, i18n.Text["out_of_range"]+"\n", path, version)
+
+		return 1
+	}
+
+	p.GotoVersion(version)
+	if err = p.ExportText(exportPath, 0, 0, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// Maximum length in runes of the text shown for each version by the log command.
+const logPreview = 60
+
+// Names of the kinds of operation, as accepted by the log command.
+var opNames = map[byte]string{
+	'C': "cut", 'D': "delete", 'I': "insert", 'L': "link", 'M': "merge", 'P': "move",
+	'R': "replace", 'S': "split", 'T': "transclude", 'X': "exchange",
+}
+
+// The name of the kind of operation that created a version.
+func opName(v ps.VersionInfo) string {
+	if v.Code == 'C' && len(v.Text) == 0 {
+		return "copy"
+	}
+
+	return opNames[v.Code]
+}
+
+// Shorten text to a single line of at most logPreview runes.
+func preview(text string) string {
+	text = strings.ReplaceAll(text, "\n", "¶")
+	if r := []rune(text); len(r) > logPreview {
+		text = string(r[:logPreview-1]) + "…"
+	}
+
+	return text
+}
+
+// Format a version in the style of a commit log entry.
+func formatVersion(n int, v ps.VersionInfo) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "version %d\nParent: %d\n", n, v.Parent)
+	if !v.Created.IsZero() {
+		fmt.Fprintf(&s, "Date:   %s\n", v.Created.Local().Format(time.DateTime))
+	}
+
+	fmt.Fprintf(&s, "\n    %s ¶%d", i18n.Text["op_"+opName(v)], v.Paragraph)
+	switch v.Code {
+	case 'M', 'S', 'X':
+	case 'P':
+		fmt.Fprintf(&s, " → ¶%d", v.Target)
+	case 'R':
+		fmt.Fprintf(&s, ": %s → %s", preview(v.Replaced), preview(v.Text))
+	default:
+		if len(v.Text) > 0 {
+			s.WriteString(": " + preview(v.Text))
+		}
+	}
+
+	return s.String() + "\n"
+}
+
+// Parse the kinds of operation accepted by the log command, separated by commas.
+func parseTypes(types string) (kinds map[string]bool, err error) {
+	kinds = make(map[string]bool)
+	for _, k := range strings.Split(types, ",") {
+		if k = strings.TrimSpace(strings.ToLower(k)); k == "" {
+			continue
+		}
+
+		if k != "copy" && !slices.Contains(slices.Collect(maps.Values(opNames)), k) {
+			return nil, fmt.Errorf(i18n.Text["unknown_type"], k)
+		}
+		kinds[k] = true
+	}
+
+	return kinds, nil
+}
+
+// Write the versions of a permascroll, most recent first, that were created
+// within a time range by certain kinds of operation.  A zero time leaves that end
+// of the range open and no kinds accepts every kind.
+func writeLog(w io.Writer, p *ps.Permascroll, after, before time.Time, kinds map[string]bool) {
+	separator := ""
+	for n := p.Versions() - 1; n > 0; n-- {
+		v := p.GetVersion(n)
+		if (len(kinds) > 0 && !kinds[opName(v)]) || v.Created.Before(after) ||
+			(!before.IsZero() && v.Created.After(before)) {
+			continue
+		}
+
+		fmt.Fprint(w, separator+formatVersion(n, v))
+		separator = "\n"
+	}
+}
+
+/*
+Print the versions of a permascroll, most recent first, optionally only those
+created within a time range or by certain kinds of operation.  Returns the exit
+status.
+*/
+func showLog(args []string) int {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	fs.Usage = flag.Usage
+	since := fs.String("since", "", i18n.Text["since"])
+	until := fs.String("until", "", i18n.Text["until"])
+	types := fs.String("type", "", i18n.Text["type"])
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	var after, before time.Time
+	var err error
+	if *since != "" {
+		after, err = parseTime(*since)
+	}
+	if err == nil && *until != "" {
+		before, err = parseTime(*until)
+	}
+
+	var kinds map[string]bool
+	if err == nil {
+		kinds, err = parseTypes(*types)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 2
+	}
+
+	path, ok := commandPath(fs.Args())
+	if !ok {
+		return 2
+	}
+
+	p, err := openReadOnly(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	writeLog(os.Stdout, p, after, before, kinds)
+
+	return 0
+}
+
+// Open a permascroll read-only for a command, reporting any damage that was
+// ignored.
+func openReadOnly(path string) (p *ps.Permascroll, err error) {
+	p = ps.New("")
+	if err = p.OpenReadOnly(path); errors.Is(err, ps.ErrRecovered) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		err = nil
+	}
+
+	return p, err
+}
+
+// Print the differences between two versions of a permascroll, by default the
+// current version.  Returns the exit status.
+func diff(args []string) int {
+	var versions []int
+	for len(args) > 0 && len(versions) < 2 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			break
+		}
+
+		versions, args = append(versions, v), args[1:]
+	}
+
+	path := defaultPermascroll
+	if len(args) > 0 {
+		path, args = args[0], args[1:]
+	}
+
+	if len(versions) == 0 || len(args) > 0 {
+		flag.Usage()
+
+		return 2
+	}
+
+	p, err := openReadOnly(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return 1
+	}
+
+	if len(versions) == 1 {
+		versions = append(versions, p.CurrentVersion())
+	}
+
+	for _, v := range versions {
+		if v < 0 || v >= p.Versions() {
+			fmt.Fprintf(os.Stderr, i18n.Text["out_of_range"]+"\n", path, v)
+
+			return 1
+		}
+	}
+
+	for _, d := range p.Diff(versions[0], versions[1]) {
+		if d.Changed() {
+			fmt.Println(formatDiff(d))
+		}
+	}
+
+	return 0
+}
+
+// Format the changes to a paragraph with a heading giving its paragraph
+// numbers, marking deleted text with [-…-] and inserted text with {+…+}.
+func formatDiff(d ps.ParagraphDiff) string {
+	var s strings.Builder
+	if d.Old > 0 {
+		fmt.Fprintf(&s, "-¶%d", d.Old)
+	}
+	if d.New > 0 {
+		if d.Old > 0 {
+			s.WriteByte(' ')
+		}
+		fmt.Fprintf(&s, "+¶%d", d.New)
+	}
+	s.WriteByte('\n')
+
+	for _, c := range d.Changes {
+		switch c.Kind {
+		case ps.Deleted:
+			s.WriteString("[-" + c.Text + "-]")
+		case ps.Inserted:
+			s.WriteString("{+" + c.Text + "+}")
+		default:
+			s.WriteString(c.Text)
+		}
+	}
+	s.WriteByte('\n')
+
+	return s.String()
+}
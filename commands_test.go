@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xanni/jotty/i18n"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+func TestParseTypes(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]struct {
+		types  string
+		expect map[string]bool
+	}{
+		"None":     {"", map[string]bool{}},
+		"Copy":     {"copy", map[string]bool{"copy": true}},
+		"Multiple": {"Cut, insert,", map[string]bool{"cut": true, "insert": true}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) {
+			kinds, err := parseTypes(test.types)
+			assert.NoError(err)
+			assert.Equal(test.expect, kinds)
+		})
+	}
+
+	_, err := parseTypes("cut,paste")
+	assert.EqualError(err, fmt.Sprintf(i18n.Text["unknown_type"], "paste"))
+}
+
+func TestWriteLog(t *testing.T) {
+	assert := assert.New(t)
+	epoch := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	p := ps.New("@1I1,0:Test\n+500S1,2\nD1,0:Te\n+20I2,0:A\n")
+	tests := map[string]struct {
+		after, before time.Time
+		kinds         map[string]bool
+		expect        []int
+	}{
+		"All":     {expect: []int{4, 3, 2, 1}},
+		"Since":   {after: epoch.Add(time.Minute + 500*time.Millisecond), expect: []int{4, 3, 2}},
+		"Until":   {before: epoch.Add(time.Minute + 500*time.Millisecond), expect: []int{3, 2, 1}},
+		"Type":    {kinds: map[string]bool{"delete": true, "split": true}, expect: []int{3, 2}},
+		"Nothing": {after: epoch.Add(time.Hour)},
+	}
+
+	versionRx := regexp.MustCompile(`(?m)^version (\d+)$`)
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) {
+			var s strings.Builder
+			writeLog(&s, p, test.after, test.before, test.kinds)
+			var versions []int
+			for _, m := range versionRx.FindAllStringSubmatch(s.String(), -1) {
+				n, _ := strconv.Atoi(m[1])
+				versions = append(versions, n)
+			}
+			assert.Equal(test.expect, versions)
+		})
+	}
+
+	date := epoch.Add(time.Minute + 500*time.Millisecond).Local().Format(time.DateTime)
+	assert.Contains(formatVersion(3, p.GetVersion(3)), "Date:   "+date+"\n", "version without a timestamp")
+}
+
+func TestParseTime(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]struct {
+		s      string
+		expect time.Time
+	}{
+		"Date":    {"2026-10-10", time.Date(2026, time.October, 10, 0, 0, 0, 0, time.Local)},
+		"Minutes": {"2026-10-10T15:04", time.Date(2026, time.October, 10, 15, 4, 0, 0, time.Local)},
+		"Seconds": {"2026-10-10T15:04:05", time.Date(2026, time.October, 10, 15, 4, 5, 0, time.Local)},
+		"Offset":  {"2026-10-10T15:04:05+10:00", time.Date(2026, time.October, 10, 5, 4, 5, 0, time.UTC)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) {
+			ts, err := parseTime(test.s)
+			assert.NoError(err)
+			assert.True(test.expect.Equal(ts), ts)
+		})
+	}
+
+	_, err := parseTime("10/10/2026")
+	assert.ErrorContains(err, `invalid time "10/10/2026"`)
+}
+
+func TestExportAt(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path, exportPath := filepath.Join(dir, "test.jot"), filepath.Join(dir, "test.txt")
+	require.NoError(t, os.WriteFile(path, []byte("JottyV1\n@1I1,0:Test\n@1D1,0:T\n"), 0o600))
+	epoch := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		version int
+		at      string
+		status  int
+		expect  string
+	}{
+		"Version":      {version: 1, status: 0, expect: "Test\n"},
+		"Time":         {version: -1, at: epoch.Add(time.Minute).Format(time.RFC3339), status: 0, expect: "Test\n"},
+		"Latest":       {version: -1, at: epoch.Add(time.Hour).Format(time.RFC3339), status: 0, expect: "est\n"},
+		"Both":         {version: 1, at: "2026-10-10", status: 2},
+		"Invalid":      {version: -1, at: "yesterday", status: 2},
+		"Too early":    {version: -1, at: epoch.Format(time.RFC3339), status: 1},
+		"Out of range": {version: 3, status: 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) {
+			_ = os.Remove(exportPath)
+			assert.Equal(test.status, exportAt(path, exportPath, "", test.version, test.at))
+			if test.status == 0 {
+				contents, err := os.ReadFile(exportPath)
+				assert.NoError(err)
+				assert.Equal(test.expect, string(contents))
+			} else {
+				assert.NoFileExists(exportPath)
+			}
+		})
+	}
+
+	contents, _ := os.ReadFile(path)
+	assert.Equal("JottyV1\n@1I1,0:Test\n@1D1,0:T\n", string(contents), "unchanged")
+}
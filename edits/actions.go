@@ -40,12 +40,21 @@ func insert(t string) {
 		updateSelections()
 	}
 
+	if !ps.SpansParagraphs() {
+		t = strings.ReplaceAll(t, "\n", " ")
+	}
+
 	if cursor[Char] >= cache[cursor[Para]-1].chars {
 		ps.AppendText(cursor[Para], t)
 	} else {
 		ps.InsertText(cursor[Para], before.Len(), t)
 	}
-	cursor[Char] += uniseg.GraphemeClusterCount(t)
+
+	if strings.Contains(t, "\n") {
+		refresh() // Move to the end of the inserted paragraphs
+	} else {
+		cursor[Char] += uniseg.GraphemeClusterCount(t)
+	}
 	initialCap = false
 	ocursor = counts{}
 	scope = Char
@@ -93,12 +102,26 @@ func IncScope() {
 	updateSelections()
 }
 
-func ClearMarks() { mark = nil; updateSelections() }
+func ClearMarks() { mark, spanPara = nil, 0; updateSelections() }
 
 func Mark() {
+	if spanPara > 0 && cursor[Para] == spanPara && cursor[Char] == spanChar {
+		spanPara = 0 // Remove the mark ending the span
+		updateSelections()
+
+		return
+	}
+
 	// Remove existing marks?
 	if markPara != cursor[Para] {
-		mark = nil
+		if len(mark) == 1 && spanPara == 0 && ps.SpansParagraphs() {
+			spanPara, spanChar = cursor[Para], cursor[Char] // End a span
+			updateSelections()
+
+			return
+		}
+
+		mark, spanPara = nil, 0
 
 		if markPara > 0 {
 			updateSelections()
@@ -109,11 +132,16 @@ func Mark() {
 		for i, m := range mark {
 			if m == cursor[Char] {
 				mark = slices.Delete(mark, i, i+1)
+				if spanPara > 0 { // The end of the span becomes the only mark
+					markPara, mark, spanPara = spanPara, []int{spanChar}, 0
+				}
 				updateSelections()
 
 				return
 			}
 		}
+
+		spanPara = 0
 	}
 
 	if len(mark) > 3 {
@@ -141,6 +169,10 @@ func exchange() {
 }
 
 func Space() {
+	if spanPara > 0 && spanSel.pend > 0 && moveSpan() {
+		return
+	}
+
 	if prevSelected || secondary.cend > secondary.cbegin {
 		exchange()
 		mark = nil
@@ -339,6 +371,12 @@ func scopeSpan() (offset int, size int) {
 }
 
 func Copy() {
+	if spanSel.pend > 0 {
+		currentCut = ps.CopySpan(spanSel.pbegin, spanSel.obegin, spanSel.pend, spanSel.oend)
+
+		return
+	}
+
 	if len(mark) > 2 && secondary.oend > secondary.obegin {
 		ps.CopyText(markPara, secondary.obegin, secondary.oend)
 	}
@@ -357,6 +395,12 @@ func Copy() {
 }
 
 func cutPrimary() {
+	if spanSel.pend > 0 {
+		cutSpan()
+
+		return
+	}
+
 	if primary.oend <= primary.obegin {
 		return
 	}
@@ -400,7 +444,9 @@ func Delete() {
 
 func Export(path string) {
 	var err error
-	if len(mark) > 0 {
+	if spanSel.pend > 0 {
+		err = ps.ExportSpan(path, spanSel.pbegin, spanSel.obegin, spanSel.pend, spanSel.oend)
+	} else if len(mark) > 0 {
 		err = ps.ExportText(path, markPara, primary.obegin, primary.oend)
 	} else {
 		updateSelections()
@@ -414,6 +460,23 @@ func Export(path string) {
 	}
 }
 
+// Import a text file at the cursor position and move the cursor to the end of
+// the imported text.
+func Import(path string) {
+	if err := ps.ImportText(path, cursor[Para], charOffset(cursor[Para], cursor[Char])); err != nil {
+		SetMode(Error, err.Error())
+
+		return
+	}
+
+	ClearMode()
+	refresh()
+	ClearMarks()
+	initialCap = false
+	ocursor = counts{}
+	scope = Char
+}
+
 func Join() {
 	csent := cache[cursor[Para]-1].csent
 	s := cursor[Sent]
@@ -469,6 +532,20 @@ func Join() {
 	ClearMarks()
 }
 
+// Update the document with records appended to a read-only permascroll by
+// another process, moving the cursor to the position of the last operation.
+func Follow() {
+	changed, err := ps.FollowPermascroll()
+	if changed {
+		refresh()
+		ClearMarks()
+	}
+
+	if err != nil && Mode != Error {
+		SetMode(Error, err.Error())
+	}
+}
+
 func refresh() {
 	cache = nil
 	total = counts{0, 0, 0, 1}
@@ -481,13 +558,19 @@ func Undo() {
 	if op > 0 {
 		refresh()
 		ClearMarks()
+		showVersions = true
 	}
 }
 
 func Redo() {
+	if selectAlternative() {
+		return
+	}
+
 	op := ps.Redo()
 	if op > 0 {
 		refresh()
 		ClearMarks()
+		showVersions = true
 	}
 }
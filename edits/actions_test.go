@@ -2,6 +2,7 @@ package edits
 
 import (
 	"os"
+	"path/filepath"
 	"slices"
 	"testing"
 
@@ -594,6 +595,70 @@ func TestExport(t *testing.T) {
 	assert.Contains(message, "failed export: ")
 }
 
+func TestFollow(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(20, 12)
+
+	name := filepath.Join(t.TempDir(), "follow.jot")
+	if err := os.WriteFile(name, []byte("JottyV1\nI1,0:One\n"), 0o600); err != nil {
+		panic(err)
+	}
+	assert.NoError(ps.OpenReadOnly(name))
+	defer func() { assert.NoError(ps.OpenPermascroll(os.DevNull)) }()
+
+	mark, markPara = []int{0}, 1
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		panic(err)
+	}
+	if _, err = f.WriteString("I1,3: two\n"); err != nil {
+		panic(err)
+	}
+
+	Follow()
+	assert.Equal(None, Mode)
+	assert.Equal("One two", ps.GetText(1))
+	assert.Equal(counts{Char: 7, Para: 1}, cursor)
+	assert.Empty(mark)
+
+	if _, err = f.WriteString("D9,0:X\n"); err != nil {
+		panic(err)
+	}
+	f.Close()
+	Follow()
+	assert.Equal(Error, Mode)
+	assert.Contains(message, "failed to follow permascroll: ")
+}
+
+func TestImport(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init("I1,0:AB\n")
+	ResizeScreen(20, 12)
+	cursor = counts{Char: 1, Para: 1}
+	drawWindow()
+
+	name := filepath.Join(t.TempDir(), "import.txt")
+	Import(name)
+	assert.Equal(Error, Mode)
+	assert.Contains(message, "failed import: ")
+
+	if err := os.WriteFile(name, []byte("One\n\nTwo\n"), 0o600); err != nil {
+		panic(err)
+	}
+	mark, markPara = []int{0}, 1
+	Import(name)
+	assert.Equal(None, Mode)
+	assert.Equal("AOne", ps.GetText(1))
+	assert.Equal("TwoB", ps.GetText(2))
+	assert.Equal(counts{Char: 3, Para: 2}, cursor)
+	assert.Empty(mark)
+
+	Undo()
+	assert.Equal("AB", ps.GetText(1))
+}
+
 func TestJoin(t *testing.T) {
 	assert := assert.New(t)
 	setupTest()
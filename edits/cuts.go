@@ -4,6 +4,7 @@ import (
 	"strings"
 	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	ps "github.com/xanni/jotty/permascroll"
 )
 
@@ -16,10 +17,7 @@ const (
 func PrevCut() {
 	if ps.Cuts() > 0 {
 		Mode = Cuts
-		currentCut--
-		if currentCut < 1 {
-			currentCut = ps.Cuts()
-		}
+		cutsPicker().prev()
 	}
 }
 
@@ -27,53 +25,50 @@ func PrevCut() {
 func NextCut() {
 	if ps.Cuts() > 0 {
 		Mode = Cuts
-		currentCut++
-		if currentCut > ps.Cuts() {
-			currentCut = 1
-		}
+		cutsPicker().next()
 	}
 }
 
-func drawCut(current bool, text string, ts time.Time) (s string) {
-	maxLen := ex - len(layout) - 2
+// Draw the timestamp of a list entry and compute the space remaining for text.
+func drawTime(current bool, ts time.Time) (s string, maxLen int) {
+	maxLen = ex - len(layout) - 2
 	if maxLen < minCut {
-		maxLen = ex - 1
-	} else {
-		switch {
-		case ts.IsZero():
-			s = strings.Repeat(" ", len(layout)+1)
-		case current:
-			s = cutCurStyle(ts.Format(layout)) + " "
-		default:
-			s = cutTimeStyle(ts.Format(layout)) + " "
-		}
+		return s, ex - 1
 	}
 
-	if current {
-		s += truncate(maxLen, text)
-	} else {
-		s += cutStyle(truncate(maxLen, text))
+	switch {
+	case ts.IsZero():
+		s = strings.Repeat(" ", len(layout)+1)
+	case current:
+		s = cutCurStyle(ts.Format(layout)) + " "
+	default:
+		s = cutTimeStyle(ts.Format(layout)) + " "
 	}
 
-	return s
+	return s, maxLen
 }
 
-// The preceding, current and following cuts.
-func cutsWindow() (w []string) {
-	w = []string{cutWinStyle(strings.Repeat("—", ex))}
-
-	if currentCut > 1 {
-		text, ts := ps.GetCut(currentCut - 1)
-		w = append(w, drawCut(false, text, ts))
+func drawCut(current bool, text string, ts time.Time) string {
+	s, maxLen := drawTime(current, ts)
+	if current {
+		s += truncate(maxLen, oneLine(text))
+	} else {
+		s += cutStyle(truncate(maxLen, oneLine(text)))
 	}
 
-	text, ts := ps.GetCut(currentCut)
-	w = append(w, drawCut(true, text, ts))
+	return s
+}
 
-	if currentCut < ps.Cuts() {
-		text, ts := ps.GetCut(currentCut + 1)
-		w = append(w, drawCut(false, text, ts))
-	}
+func cutsPicker() picker {
+	return picker{current: &currentCut, first: 1, last: ps.Cuts(), style: cutWinStyle,
+		draw: func(i int, current bool) string {
+			text, ts := ps.GetCut(i)
 
-	return w
+			return drawCut(current, text, ts)
+		},
+		choose: func() {
+			ClearMode()
+			InsertCut()
+		},
+		keys: []tea.KeyType{tea.KeyInsert, tea.KeyCtrlV}, typing: true}
 }
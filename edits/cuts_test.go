@@ -30,11 +30,11 @@ func TestCutsWindow(t *testing.T) {
 	ResizeScreen(5, 2)
 	ps.Init("I1,0:Test\nC1,0+4\n")
 	currentCut = 1
-	assert.Equal([]string{"—————", "Test"}, cutsWindow())
+	assert.Equal([]string{"—————", "Test"}, cutsPicker().window())
 
 	currentCut = ps.CopyText(1, 0, 1)
 	ps.CopyText(1, 2, 4)
-	assert.Equal([]string{"—————", "Test", "T", "st"}, cutsWindow())
+	assert.Equal([]string{"—————", "Test", "T", "st"}, cutsPicker().window())
 }
 
 func TestPrevCut(t *testing.T) {
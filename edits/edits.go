@@ -44,6 +44,8 @@ var (
 	name        string // The program name and version
 )
 
+const IconReadOnly = "🔒"
+
 const (
 	cursorCharCap = '↑' // Capitalisation indicator character
 	margin        = 6   // Up to 4 edit marks, cursor and wrap indicator
@@ -55,12 +57,19 @@ type ModeType int
 
 const (
 	None ModeType = iota
+	Alternatives
 	ConfirmOverwrite
 	ConfirmQuit
 	Cuts
 	Error
 	Help
+	Links
 	PromptExport
+	PromptImport
+	PromptLink
+	Remote
+	Replay
+	Transclusions
 )
 
 type Scope int
@@ -158,7 +167,11 @@ func cutBuffer(cutMax int) (buf string) {
 	}
 
 	text, _ := ps.GetCut(currentCut)
+	text = oneLine(text)
 	cutLen := min(uniseg.StringWidth(text), cutMax)
+	for cutLen < len(text) && !utf8.RuneStart(text[cutLen]) {
+		cutLen-- // Don't split a multibyte character
+	}
 	buf = text[:cutLen]
 	if len(text) > cutMax {
 		buf += string(moreChar)
@@ -206,6 +219,21 @@ func statusLine() string {
 		w += len(padding) + i18n.TextWidth["cut"] + uniseg.StringWidth(buf) + 2
 	}
 
+	if len(linkEnds) > 0 { // Link being created
+		t.WriteString(padding + IconLink)
+		w += len(padding) + uniseg.StringWidth(IconLink)
+	}
+
+	if ps.ReadOnly() {
+		t.WriteString(padding + IconReadOnly)
+		w += len(padding) + uniseg.StringWidth(IconReadOnly)
+	}
+
+	if session != nil {
+		t.WriteString(padding + IconShared)
+		w += len(padding) + uniseg.StringWidth(IconShared)
+	}
+
 	// Right-align help label
 	if align := ex - (w + i18n.TextWidth["help"] + len(padding)); align > 1 {
 		t.WriteString(strings.Repeat(" ", align) + helpStyle(i18n.Text["help"]))
@@ -299,20 +327,26 @@ func following(begin int) (end int) {
 
 // Set the selections based on the current edit marks and scope.
 func updateSelections() {
-	if len(mark) > 0 && cursor[Para] != markPara {
+	old := spanSel
+	spans := len(mark) == 1 && (spanPara > 0 || cursor[Para] != markPara) && ps.SpansParagraphs()
+	if len(mark) > 0 && cursor[Para] != markPara && !spans {
 		mark = nil
 	}
 
-	selectPrevPara := scope == Para && markPara > 1 && len(mark) == 1 && mark[0] == 0
+	selectPrevPara := !spans && scope == Para && markPara > 1 && len(mark) == 1 && mark[0] == 0
 	if selectPrevPara != prevSelected {
 		prevSelected = selectPrevPara
 		drawPara(markPara - 1)
 	}
 
-	switch len(mark) {
-	case 0:
+	spanSel = spanSelection{}
+	switch {
+	case spans:
+		primary, secondary = selection{}, selection{}
+		updateSpan()
+	case len(mark) == 0:
 		primary, secondary = selection{}, selection{}
-	case 1:
+	case len(mark) == 1:
 		if cursor[Char] == mark[0] {
 			primary, secondary = selection{cbegin: mark[0], cend: following(mark[0])},
 				selection{cbegin: preceding(mark[0]), cend: mark[0]}
@@ -321,7 +355,7 @@ func updateSelections() {
 			second := max(mark[0], cursor[Char])
 			primary, secondary = selection{cbegin: first, cend: second}, selection{cbegin: second, cend: following(second)}
 		}
-	case 2:
+	case len(mark) == 2:
 		first := min(mark[0], mark[1])
 		second := max(mark[0], mark[1])
 		primary, secondary = selection{cbegin: first, cend: second}, selection{cbegin: second, cend: following(second)}
@@ -332,17 +366,23 @@ func updateSelections() {
 		primary, secondary = selection{cbegin: sorted[0], cend: sorted[1]},
 			selection{cbegin: sorted[len(sorted)-2], cend: sorted[len(sorted)-1]}
 	}
+
+	if old.pend > 0 || spanSel.pend > 0 {
+		redrawSpan(old)
+	}
 }
 
 type line struct {
-	c      int             // Character count
-	m      int             // Right margin
-	pn     int             // Paragraph number
-	source *[]byte         // Paragraph text being rendered
-	state  int             // Unicode segmentation state
-	t      strings.Builder // Text
-	w      int             // Monospace width of current character
-	x      int             // Current column position in the line
+	c      int               // Character count
+	m      int               // Right margin
+	o      int               // Byte offset of the current character
+	pn     int               // Paragraph number
+	source *[]byte           // Paragraph text being rendered
+	state  int               // Unicode segmentation state
+	t      strings.Builder   // Text
+	trans  []ps.Transclusion // Transcluded text in the paragraph
+	w      int               // Monospace width of current character
+	x      int               // Current column position in the line
 }
 
 // Helper function.
@@ -375,15 +415,18 @@ func (l *line) updateSelectionOffsets() {
 
 // Draw one character in the edit window with highlighting as required.
 func (l *line) drawChar(g []byte) {
-	isPrimary := l.pn == markPara && l.c >= primary.cbegin && l.c < primary.cend
+	isPrimary := (l.pn == markPara && l.c >= primary.cbegin && l.c < primary.cend) || inSpan(l.pn, l.c)
 	isSecondary := (l.pn == markPara && l.c >= secondary.cbegin && l.c < secondary.cend) ||
 		(l.pn == markPara-1 && prevSelected)
+	isTranscluded := slices.ContainsFunc(l.trans, func(t ps.Transclusion) bool { return l.o >= t.Begin && l.o < t.End })
 
 	switch {
 	case isPrimary:
 		l.t.WriteString((primaryStyle(string(g))))
 	case isSecondary:
 		l.t.WriteString((secondaryStyle(string(g))))
+	case isTranscluded:
+		l.t.WriteString(transcludedStyle(string(g)))
 	default:
 		l.t.Write(g)
 	}
@@ -412,6 +455,10 @@ func (l *line) drawAllMarkers() {
 		}
 	}
 
+	if l.pn == spanPara && l.c == spanChar {
+		l.drawMarker(markString())
+	}
+
 	if l.pn == cursor[Para] && l.c == cursor[Char] {
 		if initialCap {
 			l.drawMarker(cursorCapString)
@@ -468,6 +515,8 @@ func (l *line) drawLine() string {
 		if f&uniseg.MaskSentence != 0 && len(*l.source) > 0 {
 			indexSent(l.pn, l.c)
 		}
+
+		l.o += len(g)
 	}
 
 	if l.x > l.m && f == 0 && !unicode.Is(unicode.Z, r) { // Not a space character
@@ -509,7 +558,7 @@ func drawPara(pn int) {
 		indexWord(pn, 0)
 	}
 
-	l := line{pn: pn, source: &source, state: -1}
+	l := line{pn: pn, source: &source, state: -1, trans: ps.Transclusions(pn)}
 	p := &cache[pn-1]
 	for {
 		p.text = append(p.text, l.drawLine())
@@ -603,8 +652,15 @@ func truncate(maxLen int, s string) string {
 	}
 
 	half := (maxLen - 1) / 2
+	begin, end := half, len(s)-half
+	for begin > 0 && !utf8.RuneStart(s[begin]) {
+		begin-- // Don't split a multibyte character
+	}
+	for end < len(s) && !utf8.RuneStart(s[end]) {
+		end++
+	}
 
-	return s[:half] + string(moreChar) + s[len(s)-half:]
+	return s[:begin] + string(moreChar) + s[end:]
 }
 
 // The entire screen including the edits window and status line.
@@ -641,11 +697,11 @@ func Screen() string {
 	}
 
 	switch Mode {
+	case Alternatives, Cuts, Links, Remote, Transclusions:
+		window := modePicker().window()
+		t = append(t[:len(t)-len(window)+1], window...)
 	case ConfirmOverwrite, ConfirmQuit:
 		t = append(t, confirmStyle(message))
-	case Cuts:
-		window := cutsWindow()
-		t = append(t[:len(t)-len(window)+1], window...)
 	case Error:
 		t = append(t, errorString()+" "+errorStyle(truncate(ex-(i18n.TextWidth["error"]+1), message)))
 	case Help:
@@ -653,9 +709,15 @@ func Screen() string {
 		t = slices.Delete(t, 0, len(window))
 		t = slices.Insert(t, 0, window...)
 		t = append(t, statusLine())
-	case PromptExport:
+	case PromptExport, PromptImport, PromptLink:
 		t = append(t, promptLine())
+	case Replay:
+		t = append(t, replayLine())
 	default:
+		if showVersions {
+			window := versionsWindow()
+			t = append(t[:len(t)-len(window)], window...)
+		}
 		t = append(t, statusLine())
 	}
 
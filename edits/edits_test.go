@@ -27,9 +27,11 @@ func setupTest() {
 	name = "J"
 	cursor = counts{Para: 1}
 	currentCut, firstPara, firstLine = 0, 0, 0
-	initialCap, prevSelected, Mode = false, false, None
-	mark, markPara = nil, 0
+	initialCap, prevSelected, showVersions, Mode = false, false, false, None
+	linkEnds, mark, markPara, spanPara, spanSel = nil, nil, 0, 0, spanSelection{}
 	primary, secondary = selection{}, selection{}
+	remotes, session = nil, nil
+	playing, replay, replayRate, replayStep = false, nil, 0, 0
 	scope = Char
 	ps.Init("")
 	resetCache()
@@ -157,6 +159,7 @@ func TestUpdateSelections(t *testing.T) {
 	assert := assert.New(t)
 	ResizeScreen(margin+3, 2)
 	setupTest()
+	ps.SplitParagraph(1, 0) // A selection spanning paragraphs needs the second paragraph
 	cache = []para{{26, []int{0, 5, 12, 16}, []int{0, 12}, []string{"Four words. Two sentences."}}}
 
 	tests := map[string]struct {
@@ -201,6 +204,17 @@ func TestUpdateSelections(t *testing.T) {
 	cursor[Para] = 1
 	updateSelections()
 	assert.False(prevSelected)
+	assert.Equal(1, spanSel.pbegin, "span from the cursor to the mark")
+	assert.Equal(2, spanSel.pend)
+
+	spanPara, spanChar = 1, 0
+	cursor[Para] = 2
+	updateSelections()
+	assert.Equal(spanSelection{pbegin: 1, pend: 2}, spanSel, "span ended by a second mark")
+
+	mark = []int{0, 1}
+	updateSelections()
+	assert.Equal(spanSelection{}, spanSel, "two marks in the same paragraph")
 }
 
 func setProfile(profile termenv.Profile) {
@@ -426,6 +440,7 @@ func TestTruncate(t *testing.T) {
 	assert := assert.New(t)
 	assert.Equal("Test", truncate(4, "Test"))
 	assert.Equal("T"+string(moreChar)+"t", truncate(3, "Test"))
+	assert.Equal("T"+string(moreChar)+"t", truncate(5, "T¶¶t"))
 }
 
 func TestScreen(t *testing.T) {
@@ -0,0 +1,153 @@
+package edits
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rivo/uniseg"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements typed links between spans of text.  "Link" adds the primary
+selection, and the secondary selection if there are three or four edit marks,
+to the ends of a new link.  Once the link has two ends the user is prompted for
+its type.  Without edit marks, "link" presents the links on the current
+paragraph for selection in the same way as the cut buffer, and the selected link
+is followed by selecting the text at its other end.
+*/
+
+const IconLink = "🔗"
+
+var (
+	currentLink int          // Index of the selected link
+	linkEnds    []ps.LinkEnd // Ends of the link being created
+	linkKind    = "see-also" // Type of the most recently created link
+	links       []ps.Link    // Links on the current paragraph
+)
+
+// Add a selection in the marked paragraph to the ends of the link being
+// created, if it is not empty.
+func addLinkEnd(s selection) {
+	if s.oend > s.obegin {
+		linkEnds = append(linkEnds, ps.LinkEnd{Paragraph: markPara, Begin: s.obegin, End: s.oend})
+	}
+}
+
+// The end of a link furthest from the cursor: the first end outside the
+// current paragraph, or otherwise the first end that does not contain the
+// cursor.
+func farEnd(l ps.Link) ps.LinkEnd {
+	offset := charOffset(cursor[Para], cursor[Char])
+	for _, e := range l.Ends {
+		if e.Paragraph != cursor[Para] {
+			return e
+		}
+	}
+
+	for _, e := range l.Ends {
+		if offset < e.Begin || offset >= e.End {
+			return e
+		}
+	}
+
+	return l.Ends[0]
+}
+
+// The text at an end of a link.
+func endText(e ps.LinkEnd) string { return ps.GetText(e.Paragraph)[e.Begin:e.End] }
+
+// True if all the ends of the link being created are still within the document.
+func validLinkEnds() bool {
+	for _, e := range linkEnds {
+		if e.Paragraph > ps.Paragraphs() || e.End > ps.GetSize(e.Paragraph) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add the selections to a new link, or list the links on the current paragraph.
+func Link() {
+	if len(mark) == 0 {
+		if links = ps.Links(cursor[Para]); len(links) > 0 {
+			currentLink = 0
+			Mode = Links
+		}
+
+		return
+	}
+
+	updateSelections()
+	if spanSel.pend > 0 || !ps.SpansParagraphs() { // Links are unsupported by the original format
+		return
+	}
+	drawPara(markPara)
+
+	if !validLinkEnds() {
+		linkEnds = nil
+	}
+
+	addLinkEnd(primary)
+	if len(mark) > 2 {
+		addLinkEnd(secondary)
+	}
+
+	ClearMarks()
+	if len(linkEnds) > 1 {
+		SetMode(PromptLink, IconLink)
+		PromptDefault(linkKind)
+	}
+}
+
+// Abandon the link being created.
+func CancelLink() {
+	ClearMode()
+	linkEnds = nil
+}
+
+// Create a link of the type entered in the prompt between the selected ends.
+func CreateLink() {
+	if kind := strings.TrimSpace(PromptResponse()); len(kind) > 0 {
+		linkKind = kind
+		ps.CreateLink(kind, linkEnds...)
+	}
+
+	CancelLink()
+}
+
+// Follow the selected link by selecting the text at its other end.
+func FollowLink() {
+	ClearMode()
+	e := farEnd(links[currentLink])
+	text := ps.GetText(e.Paragraph)
+	ClearMarks()
+	cursor = counts{Char: uniseg.GraphemeClusterCount(text[:e.Begin]), Para: e.Paragraph}
+	if e.End > e.Begin {
+		drawWindow() // Ensure the paragraph is indexed before selecting the text
+		mark, markPara = []int{uniseg.GraphemeClusterCount(text[:e.End])}, e.Paragraph
+		updateSelections()
+	}
+}
+
+func drawLink(current bool, l ps.Link) string {
+	kind := l.Kind + " "
+	maxLen := ex - uniseg.StringWidth(kind) - 1
+	if maxLen < minCut {
+		kind, maxLen = "", ex-1
+	}
+
+	text := truncate(maxLen, endText(farEnd(l)))
+	if current {
+		return cutCurStyle(kind) + text
+	}
+
+	return linkStyle(kind + text)
+}
+
+func linksPicker() picker {
+	return picker{current: &currentLink, last: len(links) - 1, style: linkStyle,
+		draw:   func(i int, current bool) string { return drawLink(current, links[i]) },
+		choose: FollowLink, keys: []tea.KeyType{tea.KeyCtrlL}, typing: true}
+}
@@ -0,0 +1,84 @@
+package edits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+func TestLink(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init("I1,0:One two\nS1,3\n")
+	ResizeScreen(20, 12)
+	drawWindow()
+
+	mark, markPara = []int{3}, 1
+	Link()
+	assert.Equal(None, Mode)
+	assert.Equal([]ps.LinkEnd{{Paragraph: 1, Begin: 0, End: 3}}, linkEnds)
+	assert.Empty(mark)
+	assert.Contains(statusLine(), IconLink)
+
+	cursor = counts{Char: 1, Para: 2}
+	drawWindow()
+	mark, markPara = []int{4}, 2
+	Link()
+	assert.Equal(PromptLink, Mode)
+	assert.Equal("see-also", PromptResponse())
+
+	PromptInsertRunes([]rune("!"))
+	CreateLink()
+	assert.Equal(None, Mode)
+	assert.Empty(linkEnds)
+	assert.Equal("see-also!", linkKind)
+	assert.Equal([]ps.Link{{Kind: "see-also!", Ends: []ps.LinkEnd{
+		{Paragraph: 1, Begin: 0, End: 3}, {Paragraph: 2, Begin: 1, End: 4},
+	}}}, ps.Links(2))
+
+	mark = []int{0, 1, 2}
+	Link()
+	assert.Equal(PromptLink, Mode, "primary and secondary selections")
+	assert.Len(linkEnds, 2)
+	CancelLink()
+	assert.Equal(None, Mode)
+	assert.Empty(linkEnds)
+}
+
+func TestFollowLink(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init("I1,0:One two\nS1,3\nL1,0+3/2,1+3:quote\nL2,0+1/2,1+1:comment\n")
+	ResizeScreen(20, 12)
+	cursor = counts{Char: 1, Para: 2}
+	drawWindow()
+
+	Link()
+	assert.Equal(Links, Mode)
+	assert.Len(links, 2)
+	assert.Equal([]string{linkStyle("————————————————————"), cutCurStyle("quote ") + "One",
+		linkStyle("comment  ")}, linksPicker().window())
+
+	linksPicker().next()
+	assert.Equal(1, currentLink)
+	assert.Equal([]string{linkStyle("————————————————————"), linkStyle("quote One"), cutCurStyle("comment ") + " "},
+		linksPicker().window())
+	linksPicker().next()
+	assert.Equal(0, currentLink)
+	linksPicker().prev()
+	assert.Equal(1, currentLink)
+
+	FollowLink()
+	assert.Equal(None, Mode)
+	assert.Equal(counts{Char: 0, Para: 2}, cursor)
+	assert.Equal([]int{1}, mark)
+
+	cursor, mark = counts{Char: 2, Para: 2}, nil
+	Link()
+	currentLink = 0
+	FollowLink()
+	assert.Equal(counts{Char: 0, Para: 1}, cursor)
+	assert.Equal([]int{3}, mark)
+	assert.Equal(1, markPara)
+}
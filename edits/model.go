@@ -6,11 +6,15 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/xanni/jotty/collab"
 	"github.com/xanni/jotty/i18n"
 	ps "github.com/xanni/jotty/permascroll"
 )
 
-const syncDelay = 10 * time.Second
+const (
+	followDelay = time.Second // Interval between checks for records appended by another process
+	syncDelay   = 10 * time.Second
+)
 
 var dispatch = map[tea.KeyType]func(){
 	tea.KeyEsc: _help,
@@ -22,18 +26,33 @@ var dispatch = map[tea.KeyType]func(){
 	tea.KeyBackspace: Backspace, tea.KeyCtrlH: Backspace,
 	tea.KeyTab: Mark, tea.KeyShiftTab: ClearMarks,
 	tea.KeyCtrlJ: Join,
+	tea.KeyCtrlL: Link,
+	tea.KeyCtrlO: _import,
 	tea.KeyEnter: Enter, tea.KeySpace: Space,
 	tea.KeyPgDown: NextCut, tea.KeyCtrlN: NextCut,
 	tea.KeyPgUp: PrevCut, tea.KeyCtrlP: PrevCut,
 	tea.KeyCtrlQ: _quit, tea.KeyCtrlW: _quit,
-	tea.KeyHome: Home, tea.KeyCtrlU: Home,
+	tea.KeyCtrlS: ListRemote,
+	tea.KeyCtrlT: Transclude,
+	tea.KeyHome:  Home, tea.KeyCtrlU: Home,
 	tea.KeyInsert: InsertCut, tea.KeyCtrlV: InsertCut,
 	tea.KeyDelete: Delete, tea.KeyCtrlX: Delete,
 	tea.KeyCtrlY: Redo, tea.KeyCtrlZ: Undo,
 }
 
-var exportDispatch = map[tea.KeyType]func(){
-	tea.KeyEsc:  ClearMode,
+// Actions that do not alter the document, for a read-only permascroll.
+var viewDispatch = map[tea.KeyType]func(){
+	tea.KeyEsc: _help,
+	tea.KeyUp:  IncScope, tea.KeyDown: DecScope,
+	tea.KeyLeft: Left, tea.KeyRight: Right,
+	tea.KeyEnd: End, tea.KeyCtrlD: End,
+	tea.KeyCtrlE: _export,
+	tea.KeyTab:   Mark, tea.KeyShiftTab: ClearMarks,
+	tea.KeyCtrlQ: _quit, tea.KeyCtrlW: _quit,
+	tea.KeyHome: Home, tea.KeyCtrlU: Home,
+}
+
+var promptDispatch = map[tea.KeyType]func(){
 	tea.KeyLeft: PromptLeft, tea.KeyRight: PromptRight,
 	tea.KeyEnd: PromptEnd, tea.KeyCtrlD: PromptEnd,
 	tea.KeyBackspace: PromptBackspace, tea.KeyCtrlH: PromptBackspace,
@@ -42,10 +61,25 @@ var exportDispatch = map[tea.KeyType]func(){
 
 var (
 	exportMarkedPath, exportPath string // Paths for export of marked portations and entire document
+	importPath                   string // Path of the most recently imported file
 	sx, sy                       int    // screen dimensions
 )
 
-type model struct{ timer *time.Timer }
+type model struct {
+	follow   bool // Follow records appended to a read-only permascroll by another process
+	restored bool // The saved editing state has been restored
+	timer    *time.Timer
+}
+
+type followMsg struct{}
+
+type sessionMsg collab.Event
+
+type syncMsg struct{}
+
+type replayMsg int // Number of the tick
+
+var syncs = make(chan struct{}, 1) // Signalled when the permascroll should be synced
 
 var m model
 
@@ -64,18 +98,29 @@ func _export() {
 	}
 }
 
+func _import() {
+	SetMode(PromptImport, IconImport)
+	PromptDefault(importPath)
+}
+
 func _help() { SetMode(Help, "") }
 func _quit() { SetMode(ConfirmQuit, i18n.Text["confirm"]) }
 
 // True if the window is sufficiently large.
 func isSizeOK() bool { return sx > margin && sy > 2 }
 
-func Run(version, path string) {
+// Run the editor.  If follow is true and the permascroll is read-only, the
+// document is updated as another process appends to the permascroll.  If s is
+// not nil, the document is shared with the other participants in the session.
+func Run(version, path string, follow bool, s collab.Session) {
 	name, exportPath = "Jotty "+version, path
+	m.follow = follow && ps.ReadOnly()
+	session = s
 
 	m.timer = time.AfterFunc(syncDelay, func() {
-		if err := ps.SyncPermascroll(); err != nil {
-			log.Printf("%+v", err)
+		select {
+		case syncs <- struct{}{}:
+		default: // A sync is already pending
 		}
 	})
 
@@ -85,49 +130,85 @@ func Run(version, path string) {
 	}
 
 	m.timer.Stop()
+	if err := saveState(); err != nil {
+		log.Printf("%+v", err)
+	}
+}
+
+// Write the permascroll to stable storage and save the editing state.
+func syncState() {
+	if err := ps.SyncPermascroll(); err != nil {
+		log.Printf("%+v", err)
+	}
+
+	if err := saveState(); err != nil {
+		log.Printf("%+v", err)
+	}
+}
+
+// Wait before checking for records appended by another process.
+func followTick() tea.Cmd {
+	return tea.Tick(followDelay, func(time.Time) tea.Msg { return followMsg{} })
+}
+
+// Wait before showing the next version of the replay.
+func replayTick() tea.Cmd {
+	replayTicks++
+	n := replayTicks
+
+	return tea.Tick(replayPause(), func(time.Time) tea.Msg { return replayMsg(n) })
+}
+
+// Wait until the permascroll should be synced.
+func waitSync() tea.Cmd {
+	return func() tea.Msg { <-syncs; return syncMsg{} }
+}
+
+// Wait for the next event from the multi-user editing session.
+func waitSession() tea.Cmd {
+	return func() tea.Msg { return sessionMsg(<-session.Events()) }
 }
 
 func (m model) Init() tea.Cmd {
-	return nil
+	cmds := []tea.Cmd{waitSync()}
+	switch {
+	case m.follow:
+		cmds = append(cmds, followTick())
+	case session != nil:
+		cmds = append(cmds, waitSession())
+	}
+
+	if Mode == Replay && playing {
+		cmds = append(cmds, replayTick())
+	}
+
+	return tea.Batch(cmds...)
 }
 
 func (m model) acceptKey(msg tea.KeyMsg) {
 	m.timer.Reset(syncDelay)
-	if f, ok := dispatch[msg.Type]; ok {
+	showVersions = false
+	if ps.ReadOnly() {
+		if f, ok := viewDispatch[msg.Type]; ok {
+			f()
+		}
+	} else if f, ok := dispatch[msg.Type]; ok {
 		f()
 	} else if msg.Type == tea.KeyRunes && !msg.Alt {
 		InsertRunes(msg.Runes)
 	}
 }
 
-func (m model) cutsKey(key tea.KeyMsg) {
-	switch key.Type {
-	case tea.KeyEsc:
-		ClearMode()
-	case tea.KeyPgDown, tea.KeyCtrlN:
-		NextCut()
-	case tea.KeyPgUp, tea.KeyCtrlP:
-		PrevCut()
-	case tea.KeySpace, tea.KeyEnter, tea.KeyInsert, tea.KeyCtrlV:
-		ClearMode()
-		InsertCut()
-	case tea.KeyRunes:
-		if !key.Alt {
-			m.timer.Reset(syncDelay)
-			ClearMode()
-			InsertRunes(key.Runes)
-		}
-	}
-}
-
 func (m model) exportKey(key tea.KeyMsg) {
-	if f, ok := exportDispatch[key.Type]; ok {
+	if f, ok := promptDispatch[key.Type]; ok {
 		f()
 
 		return
 	}
 
 	switch key.Type {
+	case tea.KeyEsc:
+		ClearMode()
 	case tea.KeyEnter:
 		path := PromptResponse()
 		if len(mark) > 0 {
@@ -148,19 +229,106 @@ func (m model) exportKey(key tea.KeyMsg) {
 	}
 }
 
+func (m model) importKey(key tea.KeyMsg) {
+	if f, ok := promptDispatch[key.Type]; ok {
+		f()
+
+		return
+	}
+
+	switch key.Type {
+	case tea.KeyEsc:
+		ClearMode()
+	case tea.KeyEnter:
+		importPath = PromptResponse()
+		Import(importPath)
+	case tea.KeyRunes, tea.KeySpace:
+		if !key.Alt {
+			PromptInsertRunes(key.Runes)
+		}
+	}
+}
+
+func (m model) linkKey(key tea.KeyMsg) {
+	if f, ok := promptDispatch[key.Type]; ok {
+		f()
+
+		return
+	}
+
+	switch key.Type {
+	case tea.KeyEsc:
+		CancelLink()
+	case tea.KeyEnter, tea.KeyCtrlL:
+		CreateLink()
+	case tea.KeyRunes, tea.KeySpace:
+		if !key.Alt {
+			PromptInsertRunes(key.Runes)
+		}
+	}
+}
+
+func (m model) replayKey(key tea.KeyMsg) tea.Cmd {
+	switch key.Type {
+	case tea.KeyEsc:
+		StopReplay()
+	case tea.KeySpace, tea.KeyEnter:
+		PlayReplay()
+		if playing {
+			return replayTick()
+		}
+	case tea.KeyUp:
+		FasterReplay()
+	case tea.KeyDown:
+		SlowerReplay()
+	case tea.KeyLeft, tea.KeyCtrlZ:
+		GotoReplay(replayStep - 1)
+	case tea.KeyRight, tea.KeyCtrlY:
+		GotoReplay(replayStep + 1)
+	case tea.KeyHome, tea.KeyCtrlU:
+		GotoReplay(0)
+	case tea.KeyEnd, tea.KeyCtrlD:
+		GotoReplay(len(replay) - 1)
+	}
+
+	return nil
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case followMsg:
+		if Mode != Replay {
+			Follow()
+		}
+
+		return m, followTick()
+	case sessionMsg:
+		HandleSession(collab.Event(msg))
+
+		return m, waitSession()
+	case replayMsg:
+		if int(msg) == replayTicks && Mode == Replay && AdvanceReplay() {
+			return m, replayTick()
+		}
+	case syncMsg:
+		syncState()
+
+		return m, waitSync()
 	case tea.WindowSizeMsg:
 		sx, sy = msg.Width, msg.Height
 		ResizeScreen(msg.Width, msg.Height)
+		if !m.restored && isSizeOK() && Mode != Replay {
+			restoreState()
+			m.restored = true
+		}
 	case tea.KeyMsg:
 		if !isSizeOK() {
 			break
 		}
 
 		switch Mode {
-		case Cuts:
-			m.cutsKey(msg)
+		case Alternatives, Cuts, Links, Remote, Transclusions:
+			m.pickerKey(modePicker(), msg)
 		case ConfirmOverwrite:
 			switch msg.Type {
 			case tea.KeyEsc:
@@ -185,6 +353,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		case PromptExport:
 			m.exportKey(msg)
+		case PromptImport:
+			m.importKey(msg)
+		case PromptLink:
+			m.linkKey(msg)
+		case Replay:
+			return m, m.replayKey(msg)
 		default:
 			m.acceptKey(msg)
 		}
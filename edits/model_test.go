@@ -3,6 +3,7 @@ package edits
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	tt "github.com/charmbracelet/x/exp/teatest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xanni/jotty/i18n"
+	ps "github.com/xanni/jotty/permascroll"
 )
 
 func setupModel(t *testing.T) *tt.TestModel {
@@ -87,6 +89,136 @@ func TestCuts(t *testing.T) {
 	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@5/5")) })
 }
 
+func TestAlternatives(t *testing.T) {
+	tm := setupModel(t)
+
+	ps.Init("I1,0:a\n1I1,0:b\n")
+	ps.Undo()
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlY})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("Insert ¶1: b")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@0/0")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlY})
+	tm.Send(tea.KeyMsg{Type: tea.KeyPgUp})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("a_")) })
+}
+
+func TestTransclusions(t *testing.T) {
+	tm := setupModel(t)
+
+	ps.Init("I1,0:abc\nS1,3\n")
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlT})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("abc")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@0/3")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlT})
+	tm.Send(tea.KeyMsg{Type: tea.KeyPgDown})
+	tm.Send(tea.KeyMsg{Type: tea.KeyPgUp})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@3/6")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlT})
+	tm.Type("d")
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@4/7")) })
+}
+
+func TestImportModel(t *testing.T) {
+	tm := setupModel(t)
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlO})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconImport)) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@0/0")) })
+
+	name := filepath.Join(t.TempDir(), "i")
+	if err := os.WriteFile(name, []byte("abc"), 0o600); err != nil {
+		panic(err)
+	}
+
+	importPath = ""
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlO})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconImport)) })
+	tm.Type(name + "x")
+	tm.Send(tea.KeyMsg{Type: tea.KeyBackspace})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@3/3")) })
+	assert.Equal(t, name, importPath)
+}
+
+func TestReadOnly(t *testing.T) {
+	tm := setupModel(t)
+
+	name := filepath.Join(t.TempDir(), "r.jot")
+	if err := os.WriteFile(name, []byte("JottyV1\nI1,0:abc\n"), 0o600); err != nil {
+		panic(err)
+	}
+
+	assert.NoError(t, ps.OpenReadOnly(name))
+	defer func() { assert.NoError(t, ps.OpenPermascroll(os.DevNull)) }()
+	tm.Send(tea.WindowSizeMsg{Width: 15, Height: 3})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@0/3")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyRight})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@1/3")) })
+	tm.Type("x")
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlX})
+	tm.Send(tea.KeyMsg{Type: tea.KeyRight})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@2/3")) })
+	assert.Equal(t, "abc", ps.GetText(1))
+	assert.Contains(t, statusLine(), IconReadOnly)
+}
+
+func TestLinks(t *testing.T) {
+	tm := setupModel(t)
+
+	ps.Init("I1,0:abc\nS1,3\nI2,0:def\nL1,0+1/2,1+2:x\n")
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("x ef")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tm.Send(tea.KeyMsg{Type: tea.KeyPgDown})
+	tm.Send(tea.KeyMsg{Type: tea.KeyPgUp})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@4/6")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tm.Send(tea.KeyMsg{Type: tea.KeyLeft})
+	tm.Send(tea.KeyMsg{Type: tea.KeyTab})
+	tm.Send(tea.KeyMsg{Type: tea.KeyRight})
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconLink)) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyHome})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnd})
+	for range len(linkKind) {
+		tm.Send(tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	tm.Type("q")
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("q d")) })
+
+	tm.Type("g")
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@5/7")) })
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyTab})
+	tm.Send(tea.KeyMsg{Type: tea.KeyLeft})
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tm.Send(tea.KeyMsg{Type: tea.KeyTab})
+	tm.Send(tea.KeyMsg{Type: tea.KeyLeft})
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlL})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconLink)) })
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@3/7")) })
+}
+
 func TestExportModel(t *testing.T) {
 	tm := setupModel(t)
 
@@ -194,3 +326,27 @@ func TestTooSmall(t *testing.T) {
 	tm.Send(tea.WindowSizeMsg{Width: 15, Height: 3})
 	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@0/0")) })
 }
+
+func TestReplayKeys(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "r.jot")
+	if err := os.WriteFile(name, []byte("JottyV1\nI1,0:abc\nI1,3:def\n"), 0o600); err != nil {
+		panic(err)
+	}
+
+	setupTest()
+	assert.NoError(t, ps.OpenReadOnly(name))
+	defer func() { assert.NoError(t, ps.OpenPermascroll(os.DevNull)) }()
+	StartReplay()
+	sx, m.timer = 0, time.NewTimer(time.Minute)
+	tm := tt.NewTestModel(t, m, tt.WithInitialTermSize(30, 3))
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconPause+" 2/2")) })
+	assert.Equal(t, "abcdef", ps.GetText(1))
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyLeft})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconPause+" 1/2")) })
+	tm.Send(tea.KeyMsg{Type: tea.KeySpace})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte(IconPause+" 2/2")) })
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tt.WaitFor(t, tm.Output(), func(bts []byte) bool { return bytes.Contains(bts, []byte("@6/6")) })
+	assert.Equal(t, None, Mode)
+}
@@ -0,0 +1,98 @@
+package edits
+
+import (
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/*
+A picker presents a list for selection in a window above the status line, in the
+same way as the cut buffer.  The window shows the selected entry between the
+entries preceding and following it, and the selection wraps around at either end
+of the list.
+*/
+type picker struct {
+	current     *int                             // Index of the selected entry
+	first, last int                              // Indices of the first and last entries
+	style       func(string) string              // Style of the window border
+	draw        func(i int, current bool) string // Draw an entry
+	choose      func()                           // Act on the selected entry
+	keys        []tea.KeyType                    // Keys other than Space and Enter that choose the selected entry
+	typing      bool                             // Typing text closes the list and inserts the text
+}
+
+// The picker for the current mode.
+func modePicker() (p picker) {
+	switch Mode {
+	case Alternatives:
+		p = alternativesPicker()
+	case Cuts:
+		p = cutsPicker()
+	case Links:
+		p = linksPicker()
+	case Remote:
+		p = remotePicker()
+	case Transclusions:
+		p = originsPicker()
+	}
+
+	return p
+}
+
+// Select the previous entry.
+func (p picker) prev() {
+	*p.current--
+	if *p.current < p.first {
+		*p.current = p.last
+	}
+}
+
+// Select the next entry.
+func (p picker) next() {
+	*p.current++
+	if *p.current > p.last {
+		*p.current = p.first
+	}
+}
+
+// The preceding, current and following entries.
+func (p picker) window() (w []string) {
+	w = []string{p.style(strings.Repeat("—", ex))}
+
+	if *p.current > p.first {
+		w = append(w, p.draw(*p.current-1, false))
+	}
+
+	w = append(w, p.draw(*p.current, true))
+
+	if *p.current < p.last {
+		w = append(w, p.draw(*p.current+1, false))
+	}
+
+	return w
+}
+
+func (m model) pickerKey(p picker, key tea.KeyMsg) {
+	switch key.Type {
+	case tea.KeyEsc:
+		ClearMode()
+	case tea.KeyPgDown, tea.KeyCtrlN:
+		p.next()
+	case tea.KeyPgUp, tea.KeyCtrlP:
+		p.prev()
+	case tea.KeySpace, tea.KeyEnter:
+		p.choose()
+	case tea.KeyRunes:
+		if p.typing && !key.Alt {
+			m.timer.Reset(syncDelay)
+			ClearMode()
+			InsertRunes(key.Runes)
+		}
+	default:
+		if slices.Contains(p.keys, key.Type) {
+			p.choose()
+		}
+	}
+}
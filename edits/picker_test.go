@@ -0,0 +1,62 @@
+package edits
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPicker(current, chosen *int) picker {
+	return picker{current: current, first: 1, last: 3, style: cutWinStyle,
+		draw:   func(i int, _ bool) string { return strconv.Itoa(i) },
+		choose: func() { *chosen = *current }, keys: []tea.KeyType{tea.KeyCtrlV}}
+}
+
+func TestPickerWindow(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(5, 3)
+	var current, chosen int
+	p := testPicker(&current, &chosen)
+
+	current = 1
+	assert.Equal([]string{"—————", "1", "2"}, p.window())
+	current = 2
+	assert.Equal([]string{"—————", "1", "2", "3"}, p.window())
+	current = 3
+	assert.Equal([]string{"—————", "2", "3"}, p.window())
+}
+
+func TestPickerKey(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	m.timer = time.NewTimer(time.Minute)
+	var current, chosen int
+	p := testPicker(&current, &chosen)
+
+	current = 3
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyPgDown})
+	assert.Equal(1, current, "wrap to first")
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyCtrlP})
+	assert.Equal(3, current, "wrap to last")
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyPgUp})
+	assert.Equal(2, current)
+
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyCtrlV})
+	assert.Equal(2, chosen)
+
+	Mode = Cuts
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	assert.Equal(Cuts, Mode, "typing ignored")
+
+	p.typing = true
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	assert.Equal(None, Mode, "typing closes the list")
+
+	Mode = Cuts
+	m.pickerKey(p, tea.KeyMsg{Type: tea.KeyEsc})
+	assert.Equal(None, Mode)
+}
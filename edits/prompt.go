@@ -13,6 +13,7 @@ example for an export file path or search string.
 
 const (
 	IconExport     = "💾"
+	IconImport     = "📂"
 	promptMargin   = 5 // Character cell width of the prompt icon, space, and right margin
 	responseCursor = "_"
 )
@@ -0,0 +1,84 @@
+package edits
+
+import (
+	"strconv"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/xanni/jotty/collab"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements multi-user editing sessions.  Events from the session are handled
+as they arrive, and the versions created by other participants are recorded.
+"Remote" presents those versions for selection in the same way as the cut
+buffer, and the selected version is adopted as the current version so that the
+user can continue editing it on their own branch.
+*/
+
+const IconShared = "👥"
+
+var (
+	currentRemote int            // Index of the selected remote version
+	remotes       []remoteInfo   // Versions created by other participants, oldest first
+	session       collab.Session // Multi-user editing session, if any
+)
+
+type remoteInfo struct {
+	version     int // Version created
+	participant int // Participant that created it
+}
+
+// Handle an event from the multi-user editing session.
+func HandleSession(e collab.Event) {
+	u := session.Handle(e)
+	if u.Remote && u.Version > 0 {
+		remotes = append(remotes, remoteInfo{u.Version, u.Participant})
+	}
+
+	if u.Changed {
+		refresh()
+		ClearMarks()
+	}
+
+	if u.Err != nil && Mode != Error {
+		SetMode(Error, u.Err.Error())
+	}
+}
+
+// Present the versions created by other participants for selection.
+func ListRemote() {
+	if len(remotes) > 0 {
+		ps.Flush()
+		currentRemote = len(remotes) - 1
+		Mode = Remote
+	}
+}
+
+// Adopt the selected remote version as the current version.
+func AdoptRemote() {
+	ClearMode()
+	ps.GotoVersion(remotes[currentRemote].version)
+	refresh()
+	ClearMarks()
+	showVersions = true
+}
+
+func drawRemote(current bool, r remoteInfo) string {
+	v := ps.GetVersion(r.version)
+	s, maxLen := drawTime(current, v.Time)
+	d := "#" + strconv.Itoa(r.participant) + " " + describeVersion(v)
+	if current {
+		s += truncate(maxLen, d)
+	} else {
+		s += versionStyle(truncate(maxLen, d))
+	}
+
+	return s
+}
+
+func remotePicker() picker {
+	return picker{current: &currentRemote, last: len(remotes) - 1, style: versionStyle,
+		draw:   func(i int, current bool) string { return drawRemote(current, remotes[i]) },
+		choose: AdoptRemote, keys: []tea.KeyType{tea.KeyCtrlS}}
+}
@@ -0,0 +1,68 @@
+package edits
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xanni/jotty/collab"
+	"github.com/xanni/jotty/i18n"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+// A session that reports a predetermined update for every event.
+type mockSession struct{ update collab.Update }
+
+func (s *mockSession) Close() error                      { return nil }
+func (s *mockSession) Events() <-chan collab.Event       { return nil }
+func (s *mockSession) Handle(collab.Event) collab.Update { return s.update }
+func (s *mockSession) Participant() int                  { return 0 }
+
+func TestHandleSession(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init("I1,0:One\nI1,3: two\n")
+	ps.GotoVersion(1)
+	session = &mockSession{collab.Update{Version: 2, Participant: 1, Remote: true}}
+	ResizeScreen(20, 12)
+	assert.Contains(statusLine(), IconShared)
+
+	HandleSession(collab.Event{})
+	assert.Equal([]remoteInfo{{2, 1}}, remotes)
+	assert.Equal(None, Mode)
+
+	session = &mockSession{collab.Update{Version: 0, Remote: true, Err: errors.New("failed")}}
+	HandleSession(collab.Event{})
+	assert.Len(remotes, 1, "version 0 is not recorded")
+	assert.Equal(Error, Mode)
+	assert.Equal("failed", message)
+}
+
+func TestRemote(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(20, 2)
+	ListRemote()
+	assert.Equal(None, Mode, "no remote versions")
+
+	ps.Init("I1,0:One\nI1,3: two\n")
+	ps.GotoVersion(0)
+	remotes = []remoteInfo{{1, 1}, {2, 2}}
+	ListRemote()
+	assert.Equal(Remote, Mode)
+	assert.Equal(1, currentRemote)
+	window := remotePicker().window()
+	assert.Len(window, 3)
+	assert.Contains(window[2], "#2 "+i18n.Text["op_insert"])
+
+	remotePicker().next()
+	assert.Equal(0, currentRemote)
+	remotePicker().prev()
+	assert.Equal(1, currentRemote)
+	remotePicker().prev()
+	AdoptRemote()
+	assert.Equal(None, Mode)
+	assert.Equal(1, ps.CurrentVersion())
+	assert.Equal("One", ps.GetText(1))
+	assert.True(showVersions)
+}
@@ -0,0 +1,130 @@
+package edits
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rivo/uniseg"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements time-lapse replay of how the document was written.  The versions on
+the path from version 0 to the version that was current when the replay started
+are restored in turn, so that each operation is animated in the edit window.
+While playing, each version is shown for the time that elapsed before the
+following operation was performed, divided by the replay speed, except that
+long pauses are shortened so that the replay never stalls.
+*/
+
+const (
+	IconPause = "⏸"
+	IconPlay  = "▶"
+)
+
+const (
+	maxReplayRate = 6                      // Fastest replay at 64 times real time
+	minReplayRate = -2                     // Slowest replay at a quarter of real time
+	replayDelay   = 100 * time.Millisecond // Pause after a version at real time if either timestamp is unknown
+	replayGap     = 2 * time.Second        // Longest pause between versions at real time
+)
+
+var (
+	playing     bool  // The replay is advancing
+	replay      []int // Versions from version 0 to the final version
+	replayRate  int   // Replay speed as a power of two multiple of real time
+	replayStep  int   // Index of the version being shown
+	replayTicks int   // Number of the most recent tick, so that earlier ticks can be ignored
+)
+
+// Show the version at a step of the replay.
+func showReplay(step int) {
+	replayStep = step
+	ps.GotoVersion(replay[step])
+	refresh()
+	ClearMarks()
+}
+
+// Start replaying the history of the current version from version 0.
+func StartReplay() {
+	replay = nil
+	for v := ps.CurrentVersion(); v > 0; v = ps.GetVersion(v).Parent {
+		replay = append(replay, v)
+	}
+	replay = append(replay, 0)
+	slices.Reverse(replay)
+
+	SetMode(Replay, "")
+	playing, replayRate = len(replay) > 1, 0
+	showReplay(0)
+}
+
+// Stop replaying and restore the final version.
+func StopReplay() {
+	ClearMode()
+	playing = false
+	showReplay(len(replay) - 1)
+}
+
+// Show the next version if the replay is playing.  Returns true if there are
+// more versions to show.
+func AdvanceReplay() bool {
+	if !playing {
+		return false
+	}
+
+	showReplay(replayStep + 1)
+	playing = replayStep < len(replay)-1
+
+	return playing
+}
+
+// Play or pause the replay, starting again from version 0 if it has finished.
+func PlayReplay() {
+	playing = !playing && len(replay) > 1
+	if playing && replayStep == len(replay)-1 {
+		showReplay(0)
+	}
+}
+
+// Pause the replay and show the version at a step, if there is one.
+func GotoReplay(step int) {
+	playing = false
+	if step >= 0 && step < len(replay) {
+		showReplay(step)
+	}
+}
+
+// Double the replay speed.
+func FasterReplay() { replayRate = min(replayRate+1, maxReplayRate) }
+
+// Halve the replay speed.
+func SlowerReplay() { replayRate = max(replayRate-1, minReplayRate) }
+
+// Time to show the current version before the next one.
+func replayPause() time.Duration {
+	pause := replayDelay
+	this, next := ps.GetVersion(replay[replayStep]).Time, ps.GetVersion(replay[replayStep+1]).Time
+	if !this.IsZero() && !next.IsZero() {
+		pause = min(max(next.Sub(this), 0), replayGap)
+	}
+
+	return time.Duration(float64(pause) / math.Exp2(float64(replayRate)))
+}
+
+// The status line during a replay.
+func replayLine() string {
+	icon := IconPause
+	if playing {
+		icon = IconPlay
+	}
+
+	s := icon + " " + strconv.Itoa(replayStep) + "/" + strconv.Itoa(len(replay)-1) + " ×" +
+		strconv.FormatFloat(math.Exp2(float64(replayRate)), 'f', -1, 64) + " "
+	v := ps.GetVersion(replay[replayStep])
+	t, maxLen := drawTime(true, v.Time)
+
+	return s + t + truncate(max(maxLen-uniseg.StringWidth(s), 1), describeVersion(v))
+}
@@ -0,0 +1,59 @@
+package edits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(40, 12)
+	ps.AppendText(1, "One")
+	ps.Flush()
+	ps.AppendText(1, " two")
+	ps.Flush()
+	ps.Undo()
+	ps.AppendText(1, " three")
+	ps.Flush()
+
+	StartReplay()
+	assert.Equal(Replay, Mode)
+	assert.Equal([]int{0, 1, 3}, replay)
+	assert.True(playing)
+	assert.Empty(ps.GetText(1))
+	assert.Equal(replayDelay, replayPause(), "version 0 has no timestamp")
+	assert.Contains(replayLine(), IconPlay+" 0/2 ×1")
+
+	SlowerReplay()
+	assert.Equal(2*replayDelay, replayPause())
+	for range maxReplayRate + 1 {
+		FasterReplay()
+	}
+	assert.Equal(maxReplayRate, replayRate)
+
+	assert.True(AdvanceReplay())
+	assert.Equal("One", ps.GetText(1))
+	assert.Equal(counts{Char: 3, Para: 1}, cursor)
+	assert.LessOrEqual(replayPause(), replayGap)
+	assert.False(AdvanceReplay(), "finished")
+	assert.Equal("One three", ps.GetText(1))
+
+	PlayReplay()
+	assert.True(playing)
+	assert.Zero(replayStep, "restarted")
+
+	GotoReplay(2)
+	assert.False(playing)
+	assert.Equal("One three", ps.GetText(1))
+	assert.Contains(replayLine(), IconPause+" 2/2 ×64")
+	GotoReplay(3)
+	assert.Equal(2, replayStep, "beyond the end")
+	GotoReplay(1)
+
+	StopReplay()
+	assert.Equal(None, Mode)
+	assert.Equal(3, ps.CurrentVersion())
+}
@@ -0,0 +1,131 @@
+package edits
+
+import (
+	"strings"
+
+	"github.com/rivo/uniseg"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements selections spanning paragraphs.  A single edit mark selects the text
+between the mark and the cursor even when the cursor is moved to a different
+paragraph, and adding a mark in that paragraph fixes the end of the selection.
+The selection can then be cut, copied, deleted or exported as a single operation
+that retains the paragraph breaks.  Once the end of the selection is fixed, the
+cursor can be moved elsewhere and "space" moves the paragraphs containing the
+selection to the cursor paragraph as a single operation.
+*/
+
+// A selection spanning paragraphs.
+type spanSelection struct {
+	pbegin, cbegin int // Paragraph and character position of the beginning
+	pend, cend     int // Paragraph and character position of the end
+	obegin, oend   int // Byte offsets within the beginning and ending paragraphs
+}
+
+var (
+	spanPara, spanChar int           // Position of the mark ending a selection spanning paragraphs, if any
+	spanSel            spanSelection // Primary selection spanning paragraphs, if any
+)
+
+// Byte offset of character position c in paragraph pn.
+func charOffset(pn, c int) (offset int) {
+	source, state := ps.GetText(pn), -1
+	for n := 0; len(source) > 0; {
+		g, rest, f, s := uniseg.StepString(source, state)
+		if f>>uniseg.ShiftWidth > 0 {
+			if n == c {
+				break
+			}
+			n++
+		}
+		offset += len(g)
+		source, state = rest, s
+	}
+
+	return offset
+}
+
+// True if character c in paragraph pn is within the selection spanning paragraphs.
+func inSpan(pn, c int) bool {
+	return spanSel.pend > 0 && pn >= spanSel.pbegin && pn <= spanSel.pend &&
+		(pn > spanSel.pbegin || c >= spanSel.cbegin) && (pn < spanSel.pend || c < spanSel.cend)
+}
+
+// Paragraph breaks in text are displayed as paragraph symbols.
+func oneLine(text string) string { return strings.ReplaceAll(text, "\n", string(counterChar[Para])) }
+
+// Redraw the cached paragraphs that were or are within a selection spanning paragraphs.
+func redrawSpan(old spanSelection) {
+	first, last := spanSel.pbegin, spanSel.pend
+	if old.pend > 0 {
+		if last == 0 {
+			first, last = old.pbegin, old.pend
+		} else {
+			first, last = min(first, old.pbegin), max(last, old.pend)
+		}
+	}
+
+	for pn := first; pn <= min(last, len(cache)); pn++ {
+		if pn != cursor[Para] {
+			drawPara(pn)
+		}
+	}
+}
+
+// Set the selection between the mark and either the mark ending the span or the cursor.
+func updateSpan() {
+	begin, end := [2]int{markPara, mark[0]}, [2]int{cursor[Para], cursor[Char]}
+	if spanPara > 0 {
+		end = [2]int{spanPara, spanChar}
+	}
+
+	if end[0] < begin[0] || (end[0] == begin[0] && end[1] < begin[1]) {
+		begin, end = end, begin
+	}
+
+	spanSel = spanSelection{pbegin: begin[0], cbegin: begin[1], pend: end[0], cend: end[1]}
+	spanSel.obegin, spanSel.oend = charOffset(begin[0], begin[1]), charOffset(end[0], end[1])
+}
+
+// Cut the selection spanning paragraphs.
+func cutSpan() {
+	currentCut = ps.CutSpan(spanSel.pbegin, spanSel.obegin, spanSel.pend, spanSel.oend)
+	refresh()
+	ClearMarks()
+	drawWindow()
+}
+
+// The paragraphs containing the selection spanning paragraphs, excluding the
+// last paragraph if the selection ends at its beginning.
+func spanParagraphs() (pn, count int) {
+	end := spanSel.pend
+	if spanSel.cend == 0 {
+		end--
+	}
+
+	return spanSel.pbegin, end - spanSel.pbegin + 1
+}
+
+// Move the paragraphs containing the selection spanning paragraphs before the
+// cursor paragraph if it precedes them or after it if it follows them.  Returns
+// false if the cursor is within them.
+func moveSpan() bool {
+	pn, count := spanParagraphs()
+	dest := cursor[Para]
+	switch {
+	case dest < pn:
+	case dest >= pn+count:
+		dest -= count - 1
+	default:
+		return false
+	}
+
+	ps.MoveParagraphs(pn, count, dest)
+	refresh()
+	ClearMarks()
+	drawWindow()
+
+	return true
+}
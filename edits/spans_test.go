@@ -0,0 +1,173 @@
+package edits
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+const spansText = "I1,0:One\nS1,3\nI2,0:Two\nS2,3\nI3,0:Three\n"
+
+func TestCharOffset(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.AppendText(1, "a​bé")
+
+	assert.Equal(0, charOffset(1, 0))
+	assert.Equal(4, charOffset(1, 1)) // Zero width characters belong to the preceding position
+	assert.Equal(5, charOffset(1, 2))
+	assert.Equal(7, charOffset(1, 3))
+}
+
+func TestInSpan(t *testing.T) {
+	assert := assert.New(t)
+	spanSel = spanSelection{}
+	assert.False(inSpan(1, 0))
+
+	spanSel = spanSelection{pbegin: 1, cbegin: 1, pend: 3, cend: 2}
+	assert.False(inSpan(1, 0))
+	assert.True(inSpan(1, 1))
+	assert.True(inSpan(2, 0))
+	assert.True(inSpan(3, 1))
+	assert.False(inSpan(3, 2))
+	assert.False(inSpan(4, 0))
+	spanSel = spanSelection{}
+}
+
+func TestOneLine(t *testing.T) {
+	assert.Equal(t, "One¶Two", oneLine("One\nTwo"))
+}
+
+func TestSpans(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init(spansText)
+	ResizeScreen(20, 12)
+	drawWindow()
+
+	cursor = counts{Char: 1, Para: 1}
+	Mark()
+	cursor = counts{Char: 2, Para: 3}
+	drawWindow()
+	updateSelections()
+	assert.Equal([]int{1}, mark)
+	assert.Equal(spanSelection{1, 1, 3, 2, 1, 2}, spanSel)
+	assert.Equal(selection{}, primary)
+	assert.Contains(Screen(), primaryStyle("w"))
+
+	Copy()
+	text, _ := ps.GetCut(currentCut)
+	assert.Equal("ne\nTwo\nTh", text)
+	assert.Contains(cutBuffer(20), "ne¶Two¶")
+
+	Mark()
+	assert.Equal(3, spanPara)
+	cursor = counts{Char: 0, Para: 2}
+	updateSelections()
+	assert.Equal(spanSelection{1, 1, 3, 2, 1, 2}, spanSel, "fixed end")
+
+	path := filepath.Join(t.TempDir(), "span.txt")
+	Export(path)
+	exported, _ := os.ReadFile(path)
+	assert.Equal("ne\n\nTwo\n\nTh\n", string(exported))
+
+	cursor = counts{Char: 2, Para: 3}
+	Mark()
+	assert.Zero(spanPara, "remove end")
+	Mark()
+	cursor = counts{Char: 1, Para: 1}
+	Mark()
+	assert.Equal(3, markPara, "end becomes the only mark")
+	assert.Equal([]int{2}, mark)
+	assert.Zero(spanPara)
+
+	cursor = counts{Char: 0, Para: 1}
+	updateSelections()
+	cut()
+	assert.Equal(1, ps.Paragraphs())
+	assert.Equal("ree", ps.GetText(1))
+	assert.Equal(counts{Char: 0, Para: 1}, cursor)
+	assert.Nil(mark)
+	assert.Equal(spanSelection{}, spanSel)
+
+	InsertCut()
+	assert.Equal(3, ps.Paragraphs())
+	assert.Equal("Three", ps.GetText(3))
+	assert.Equal(counts{Char: 2, Para: 3}, cursor)
+}
+
+func TestSpanInsert(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init(spansText)
+	ResizeScreen(20, 12)
+	drawWindow()
+
+	cursor = counts{Char: 2, Para: 1}
+	Mark()
+	cursor = counts{Char: 1, Para: 2}
+	drawWindow()
+	updateSelections()
+	InsertRunes([]rune("X"))
+	assert.Equal("OnXwo", ps.GetText(1))
+	assert.Equal(2, ps.Paragraphs())
+	assert.Equal([]int{3, 1}, []int{cursor[Char], cursor[Para]})
+
+	cursor = counts{Char: 0, Para: 2}
+	drawWindow()
+	Mark()
+	cursor = counts{Char: 5, Para: 2}
+	Mark()
+	cursor = counts{Char: 0, Para: 1}
+	drawWindow()
+	updateSelections()
+	assert.Nil(mark, "marks in one paragraph are cleared when the cursor leaves it")
+}
+
+func TestMoveSpan(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init(spansText + "S3,5\nI4,0:Four\n")
+	ResizeScreen(20, 12)
+	drawWindow()
+	allText := func() (text []string) {
+		for pn := 1; pn <= ps.Paragraphs(); pn++ {
+			text = append(text, ps.GetText(pn))
+		}
+
+		return text
+	}
+
+	cursor = counts{Char: 1, Para: 1}
+	Mark()
+	cursor = counts{Char: 0, Para: 3}
+	drawWindow()
+	Mark()
+	cursor = counts{Char: 2, Para: 4}
+	drawWindow()
+	updateSelections()
+	Space()
+	assert.Equal([]string{"Three", "Four", "One", "Two"}, allText())
+	assert.Equal(counts{Char: 0, Para: 3}, cursor)
+	assert.Nil(mark)
+	assert.Zero(spanPara)
+
+	ps.Undo()
+	assert.Equal([]string{"One", "Two", "Three", "Four"}, allText())
+	ps.Redo()
+	assert.Equal([]string{"Three", "Four", "One", "Two"}, allText())
+
+	Mark()
+	cursor = counts{Char: 1, Para: 4}
+	drawWindow()
+	Mark()
+	cursor = counts{Char: 0, Para: 1}
+	drawWindow()
+	updateSelections()
+	Space()
+	assert.Equal([]string{"One", "Two", "Three", "Four"}, allText())
+	assert.Equal(counts{Char: 0, Para: 1}, cursor)
+}
@@ -0,0 +1,103 @@
+package edits
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rivo/uniseg"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements persistence of the editing state that is not recorded in the
+permascroll.  The cursor, scope, edit marks, current cut and scroll position are
+saved to a sidecar file next to the permascroll whenever it is synced and on
+exit, and restored when it is next opened provided that the document is still
+at the same version.  The state file can always be safely deleted.
+*/
+
+const stateSuffix = ".state" // Appended to the permascroll path
+
+// Serialised editing state.
+type stateType struct {
+	Version    int    `json:"version"` // Version of the document that the state applies to
+	Cursor     counts `json:"cursor"`
+	Scope      Scope  `json:"scope"`
+	Mark       []int  `json:"mark"`
+	MarkPara   int    `json:"markPara"`
+	CurrentCut int    `json:"currentCut"`
+	FirstPara  int    `json:"firstPara"`
+	FirstLine  int    `json:"firstLine"`
+	Width      int    `json:"width"` // Width of the edit window, which determines the lines of each paragraph
+}
+
+// True if a character position is within a paragraph of the document.
+func validPos(pn, c int) bool {
+	return pn >= 1 && pn <= ps.Paragraphs() && c >= 0 && c <= uniseg.GraphemeClusterCount(ps.GetText(pn))
+}
+
+// True if the state is consistent with the current version of the document.
+func (s stateType) valid() bool {
+	if s.Version != ps.CurrentVersion() || !validPos(s.Cursor[Para], s.Cursor[Char]) || s.Scope < Char ||
+		s.Scope >= MaxScope || len(s.Mark) > 4 || s.CurrentCut < 0 || s.CurrentCut > ps.Cuts() ||
+		s.FirstPara < 0 || s.FirstPara > ps.Paragraphs() || s.FirstLine < 0 {
+		return false
+	}
+
+	for _, c := range s.Mark {
+		if !validPos(s.MarkPara, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Restore the editing state saved for the current version of the document, if
+// any.  The edit window must already be sized.
+func restoreState() {
+	path := ps.Path()
+	if path == "" {
+		return
+	}
+
+	var s stateType
+	b, err := os.ReadFile(path + stateSuffix)
+	if err != nil || json.Unmarshal(b, &s) != nil || !s.valid() {
+		return
+	}
+
+	cursor, scope, mark, markPara, currentCut = s.Cursor, s.Scope, s.Mark, s.MarkPara, s.CurrentCut
+	firstPara, firstLine = s.FirstPara, 0
+	if s.Width == ex {
+		firstLine = s.FirstLine
+	}
+
+	drawWindow()
+	updateSelections()
+}
+
+// Save the editing state, unless the permascroll is read-only or not stored in
+// a file.
+func saveState() error {
+	path := ps.Path()
+	if path == "" || ps.ReadOnly() {
+		return nil
+	}
+
+	ps.Flush()
+	b, err := json.Marshal(stateType{
+		Version: ps.CurrentVersion(), Cursor: cursor, Scope: scope, Mark: mark, MarkPara: markPara,
+		CurrentCut: currentCut, FirstPara: firstPara, FirstLine: firstLine, Width: ex,
+	})
+	if err == nil {
+		err = os.WriteFile(path+stateSuffix, b, 0o644) // nolint:gosec
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return err
+}
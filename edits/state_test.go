@@ -0,0 +1,58 @@
+package edits
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+func TestState(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(20, 12)
+
+	name := filepath.Join(t.TempDir(), "state.jot")
+	assert.NoError(ps.OpenPermascroll(name))
+	defer func() {
+		assert.NoError(ps.ClosePermascroll())
+		assert.NoError(ps.OpenPermascroll(os.DevNull))
+	}()
+
+	ps.AppendText(1, "One two")
+	ps.SplitParagraph(1, 7)
+	ps.AppendText(2, "Three four")
+	cursor, scope, mark, markPara, currentCut = counts{Char: 5, Para: 2}, Word, []int{0}, 2, 0
+	firstPara, firstLine = 1, 1
+	assert.NoError(saveState())
+	assert.FileExists(name + stateSuffix)
+
+	reset := func() {
+		cursor, scope, mark, markPara, currentCut = counts{Para: 1}, Char, nil, 0, 0
+		firstPara, firstLine, primary = 0, 0, selection{}
+		ResizeScreen(20, 12)
+	}
+
+	reset()
+	restoreState()
+	assert.Equal(counts{5, 1, 1, 2}, cursor)
+	assert.Equal(Word, scope)
+	assert.Equal([]int{0}, mark)
+	assert.Equal(2, markPara)
+	assert.Equal(1, firstPara)
+	assert.Equal(1, firstLine)
+	assert.Equal(5, primary.cend, "selection")
+
+	ResizeScreen(30, 12)
+	restoreState()
+	assert.Zero(firstLine, "different width")
+
+	ps.AppendText(2, "!")
+	ps.Flush()
+	reset()
+	restoreState()
+	assert.Equal(counts{Para: 1}, cursor, "different version")
+	assert.Empty(mark)
+}
@@ -8,16 +8,19 @@ import (
 )
 
 const (
-	confirmColor   = "11" // Confirmation message: ANSIBrightYellow
-	cutColor       = "8"  // Cut text: ANSIBrightBlack
-	errorColor     = "9"  // Error message: ANSIBrightRed
-	helpColor      = "14" // Help text: ANSIBrightCyan
-	markColor      = "11" // Edit mark: ANSIBrightYellow
-	primaryColor   = "9"  // Primary selection: ANSIBrightRed
-	promptColor    = "11" // Input prompt: ANSIBrightYellow
-	responseColor  = "10" // Input response: ANSIBrightGreen
-	secondaryColor = "13" // Secondary selection: ANSIBrightMagenta
-	truncatedColor = "12" // Truncated response: ANSIBrightBlue
+	confirmColor     = "11" // Confirmation message: ANSIBrightYellow
+	cutColor         = "8"  // Cut text: ANSIBrightBlack
+	errorColor       = "9"  // Error message: ANSIBrightRed
+	helpColor        = "14" // Help text: ANSIBrightCyan
+	linkColor        = "10" // Link: ANSIBrightGreen
+	markColor        = "11" // Edit mark: ANSIBrightYellow
+	primaryColor     = "9"  // Primary selection: ANSIBrightRed
+	promptColor      = "11" // Input prompt: ANSIBrightYellow
+	responseColor    = "10" // Input response: ANSIBrightGreen
+	secondaryColor   = "13" // Secondary selection: ANSIBrightMagenta
+	transcludedColor = "12" // Transcluded text: ANSIBrightBlue
+	truncatedColor   = "12" // Truncated response: ANSIBrightBlue
+	versionColor     = "6"  // Version description: ANSICyan
 )
 
 var (
@@ -76,6 +79,11 @@ func helpStyle(s string) string {
 	return output.String(s).Foreground(output.Color(helpColor)).String()
 }
 
+// Unselected link and link window.
+func linkStyle(s string) string {
+	return output.String(s).Foreground(output.Color(linkColor)).String()
+}
+
 func primaryStyle(s string) string {
 	return output.String(s).Reverse().Foreground(output.Color(primaryColor)).String()
 }
@@ -92,6 +100,15 @@ func secondaryStyle(s string) string {
 	return output.String(s).Underline().Foreground(output.Color(secondaryColor)).String()
 }
 
+func transcludedStyle(s string) string {
+	return output.String(s).Italic().Foreground(output.Color(transcludedColor)).String()
+}
+
 func truncatedStyle(s string) string {
 	return output.String(s).Reverse().Foreground(output.Color(truncatedColor)).String()
 }
+
+// Unselected version and version window.
+func versionStyle(s string) string {
+	return output.String(s).Foreground(output.Color(versionColor)).String()
+}
@@ -0,0 +1,94 @@
+package edits
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rivo/uniseg"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements transclusion of earlier primedia.  "Transclude" presents the text
+inserted by earlier versions of the document for selection in the same way as
+the cut buffer, and the selected text is transcluded at the cursor position.
+When the cursor is within transcluded text, "transclude" instead jumps to its
+origin by moving the document to the version that inserted it.
+*/
+
+var (
+	currentOrigin int   // Index of the selected origin
+	origins       []int // Versions whose primedia can be transcluded, oldest first
+)
+
+// The transcluded text at the cursor position, if any.
+func cursorTransclusion() (t ps.Transclusion, ok bool) {
+	offset := charOffset(cursor[Para], cursor[Char])
+	for _, t = range ps.Transclusions(cursor[Para]) {
+		if offset >= t.Begin && offset < t.End {
+			return t, true
+		}
+	}
+
+	return t, false
+}
+
+// Move the document to the version that inserted the primedia of transcluded
+// text and place the cursor at the beginning of the text.
+func jumpOrigin(t ps.Transclusion) {
+	ps.GotoVersion(t.Version)
+	v := ps.GetVersion(t.Version)
+	refresh()
+	ClearMarks()
+	cursor = counts{uniseg.GraphemeClusterCount(ps.GetText(v.Paragraph)[:v.Offset+t.Offset]), 0, 0, v.Paragraph}
+	showVersions = true
+}
+
+// Transclude earlier primedia, or jump to the origin of transcluded text.
+func Transclude() {
+	if t, ok := cursorTransclusion(); ok {
+		jumpOrigin(t)
+
+		return
+	}
+
+	if origins = ps.Primedia(); len(origins) > 0 {
+		currentOrigin = len(origins) - 1
+		Mode = Transclusions
+	}
+}
+
+// Transclude the selected primedia at the cursor position.
+func TranscludeOrigin() {
+	ClearMode()
+	if len(mark) > 0 {
+		cutPrimary()
+	} else {
+		updateSelections()
+	}
+
+	v := origins[currentOrigin]
+	text := ps.GetVersion(v).Text
+	ps.Transclude(cursor[Para], charOffset(cursor[Para], cursor[Char]), v, 0, len(text))
+	cursor[Char] += uniseg.GraphemeClusterCount(text)
+	initialCap = false
+	ocursor = counts{}
+	scope = Char
+}
+
+func drawOrigin(current bool, v ps.VersionInfo) string {
+	s, maxLen := drawTime(current, v.Time)
+	if current {
+		s += truncate(maxLen, v.Text)
+	} else {
+		s += transcludedStyle(truncate(maxLen, v.Text))
+	}
+
+	return s
+}
+
+func originsPicker() picker {
+	return picker{current: &currentOrigin, last: len(origins) - 1, style: transcludedStyle,
+		draw: func(i int, current bool) string {
+			return drawOrigin(current, ps.GetVersion(origins[i]))
+		},
+		choose: TranscludeOrigin, keys: []tea.KeyType{tea.KeyCtrlT}, typing: true}
+}
@@ -0,0 +1,57 @@
+package edits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+func TestOrigins(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(5, 2)
+	ps.Init("I1,0:One\nS1,3\nI2,0:Two\n")
+
+	Transclude()
+	assert.Equal(Transclusions, Mode)
+	assert.Equal([]int{1, 3}, origins)
+	assert.Equal(1, currentOrigin)
+	assert.Equal([]string{transcludedStyle("—————"), transcludedStyle("One"), "Two"}, originsPicker().window())
+
+	originsPicker().next()
+	assert.Equal(0, currentOrigin)
+	assert.Equal([]string{transcludedStyle("—————"), "One", transcludedStyle("Two")}, originsPicker().window())
+	originsPicker().prev()
+	assert.Equal(1, currentOrigin)
+	originsPicker().prev()
+	assert.Equal(0, currentOrigin)
+}
+
+func TestTransclude(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init("I1,0:One two\nS1,7\n")
+	ResizeScreen(20, 12)
+	cursor = counts{Para: 2}
+	drawWindow()
+
+	Transclude()
+	TranscludeOrigin()
+	assert.Equal(None, Mode)
+	assert.Equal("One two", ps.GetText(2))
+	assert.Equal(counts{Char: 7, Para: 2}, cursor)
+	assert.Contains(Screen(), transcludedStyle("w"))
+
+	cursor = counts{Char: 4, Para: 2}
+	_, ok := cursorTransclusion()
+	assert.True(ok)
+
+	Transclude()
+	assert.Equal(1, ps.CurrentVersion())
+	assert.Equal(counts{Char: 0, Para: 1}, cursor, "beginning of the origin")
+	assert.True(showVersions)
+
+	_, ok = cursorTransclusion()
+	assert.False(ok)
+}
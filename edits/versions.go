@@ -0,0 +1,159 @@
+package edits
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/xanni/jotty/i18n"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+/*
+Implements the version window and selection between alternative versions of the
+document.  The version window shows the neighbourhood of the current version in
+the version tree after "undo" or "redo".  When the same state has been edited
+more than once there are several versions that Redo could restore, so the user
+is presented with the alternatives in order to choose between them.
+*/
+
+const maxAncestors = 2 // Ancestors of the current version shown in the version window
+
+var (
+	alternatives []int // Child versions of the current version
+	currentAlt   int   // Index of the selected alternative
+	showVersions bool  // Display the version window
+)
+
+// Describe the operation that produced a version in a single line.
+func describeVersion(v ps.VersionInfo) (s string) {
+	pn := " " + string(counterChar[Para]) + strconv.Itoa(v.Paragraph)
+	v.Replaced, v.Text = oneLine(v.Replaced), oneLine(v.Text)
+	switch v.Code {
+	case 'C':
+		if len(v.Text) == 0 {
+			return i18n.Text["op_copy"] + pn
+		}
+		s = i18n.Text["op_cut"] + pn + ": " + v.Text
+	case 'D':
+		s = i18n.Text["op_delete"] + pn + ": " + v.Text
+	case 'I':
+		s = i18n.Text["op_insert"] + pn + ": " + v.Text
+	case 'L':
+		s = i18n.Text["op_link"] + pn + ": " + v.Text
+	case 'M':
+		s = i18n.Text["op_merge"] + pn
+	case 'P':
+		s = i18n.Text["op_move"] + pn + " → " + string(counterChar[Para]) + strconv.Itoa(v.Target)
+	case 'R':
+		s = i18n.Text["op_replace"] + pn + ": " + v.Replaced + " → " + v.Text
+	case 'S':
+		s = i18n.Text["op_split"] + pn
+	case 'T':
+		s = i18n.Text["op_transclude"] + pn + ": " + v.Text
+	case 'X':
+		s = i18n.Text["op_exchange"] + pn
+	default: // Version 0
+		s = i18n.Text["op_none"]
+	}
+
+	return s
+}
+
+// Restore the selected alternative.
+func RedoAlternative() {
+	ClearMode()
+	ps.GotoVersion(alternatives[currentAlt])
+	refresh()
+	ClearMarks()
+	showVersions = true
+}
+
+func drawAlternative(current bool, v ps.VersionInfo) string {
+	s, maxLen := drawTime(current, v.Time)
+	if current {
+		s += truncate(maxLen, describeVersion(v))
+	} else {
+		s += versionStyle(truncate(maxLen, describeVersion(v)))
+	}
+
+	return s
+}
+
+func alternativesPicker() picker {
+	return picker{current: &currentAlt, last: len(alternatives) - 1, style: versionStyle,
+		draw: func(i int, current bool) string {
+			return drawAlternative(current, ps.GetVersion(alternatives[i]))
+		},
+		choose: RedoAlternative, keys: []tea.KeyType{tea.KeyCtrlY}}
+}
+
+// Offer a choice of alternatives if there are several versions to redo.
+func selectAlternative() bool {
+	ps.Flush()
+	v := ps.GetVersion(ps.CurrentVersion())
+	if len(v.Children) < 2 {
+		return false
+	}
+
+	alternatives = v.Children
+	currentAlt = max(slices.Index(alternatives, v.Redo), 0)
+	Mode = Alternatives
+
+	return true
+}
+
+// Draw one version in the version window.
+func drawVersion(prefix string, n int, v ps.VersionInfo) string {
+	return truncate(ex-1, prefix+" "+strconv.Itoa(n)+" "+describeVersion(v))
+}
+
+/*
+The neighbourhood of the current version in the version tree: its closest
+ancestors, the current version itself and all of its children, with the child
+that Redo will follow indicated by an arrow.
+*/
+func versionsWindow() (w []string) {
+	n := ps.CurrentVersion()
+	v := ps.GetVersion(n)
+
+	var ancestors []string
+	for a := n; a > 0 && len(ancestors) < maxAncestors; {
+		a = ps.GetVersion(a).Parent
+		ancestors = append(ancestors, versionStyle(drawVersion("○", a, ps.GetVersion(a))))
+	}
+
+	for len(ancestors) > 0 && 2+len(ancestors)+len(v.Children) >= ey {
+		ancestors = ancestors[:len(ancestors)-1] // Drop the most distant ancestors first
+	}
+
+	w = []string{versionStyle(strings.Repeat("—", ex))}
+	for _, l := range slices.Backward(ancestors) {
+		w = append(w, l)
+	}
+
+	w = append(w, cutCurStyle(drawVersion("●", n, v)))
+	for i, c := range v.Children {
+		prefix := "├"
+		if i == len(v.Children)-1 {
+			prefix = "└"
+		}
+
+		if c == v.Redo {
+			w = append(w, drawVersion(prefix+"▸", c, ps.GetVersion(c)))
+		} else {
+			w = append(w, versionStyle(drawVersion(prefix+"─", c, ps.GetVersion(c))))
+		}
+	}
+
+	if len(w) >= ey {
+		if ey < 3 { // Only room for the current version
+			return w[1+len(ancestors) : 2+len(ancestors)]
+		}
+
+		w = w[:ey-1]
+	}
+
+	return w
+}
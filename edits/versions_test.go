@@ -0,0 +1,108 @@
+package edits
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xanni/jotty/i18n"
+	ps "github.com/xanni/jotty/permascroll"
+)
+
+func TestDescribeVersion(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]struct {
+		v      ps.VersionInfo
+		expect string
+	}{
+		"None":    {ps.VersionInfo{}, i18n.Text["op_none"]},
+		"Copy":    {ps.VersionInfo{Code: 'C', Paragraph: 1}, i18n.Text["op_copy"] + " ¶1"},
+		"Cut":     {ps.VersionInfo{Code: 'C', Paragraph: 1, Text: "Te"}, i18n.Text["op_cut"] + " ¶1: Te"},
+		"Delete":  {ps.VersionInfo{Code: 'D', Paragraph: 2, Text: "e"}, i18n.Text["op_delete"] + " ¶2: e"},
+		"Insert":  {ps.VersionInfo{Code: 'I', Paragraph: 1, Text: "Test"}, i18n.Text["op_insert"] + " ¶1: Test"},
+		"Link":    {ps.VersionInfo{Code: 'L', Paragraph: 1, Text: "quote"}, i18n.Text["op_link"] + " ¶1: quote"},
+		"Merge":   {ps.VersionInfo{Code: 'M', Paragraph: 3}, i18n.Text["op_merge"] + " ¶3"},
+		"Move":    {ps.VersionInfo{Code: 'P', Paragraph: 4, Target: 1}, i18n.Text["op_move"] + " ¶4 → ¶1"},
+		"Replace": {ps.VersionInfo{Code: 'R', Paragraph: 1, Replaced: "T", Text: "B"}, i18n.Text["op_replace"] + " ¶1: T → B"},
+		"Split":   {ps.VersionInfo{Code: 'S', Paragraph: 1}, i18n.Text["op_split"] + " ¶1"},
+		"Transclude": {
+			ps.VersionInfo{Code: 'T', Paragraph: 2, Text: "Te"}, i18n.Text["op_transclude"] + " ¶2: Te",
+		},
+		"Exchange": {ps.VersionInfo{Code: 'X', Paragraph: 2}, i18n.Text["op_exchange"] + " ¶2"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) { assert.Equal(test.expect, describeVersion(test.v)) })
+	}
+}
+
+func TestSelectAlternative(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ps.Init("I1,0:Test\nR1,0:T\tB\n1R1,0:T\tR\n")
+
+	Redo()
+	assert.Equal(None, Mode)
+
+	ps.Undo()
+	Redo()
+	assert.Equal(Alternatives, Mode)
+	assert.Equal([]int{2, 3}, alternatives)
+	assert.Equal(1, currentAlt)
+
+	ResizeScreen(24, 2)
+	expect := []string{strings.Repeat("—", 24), i18n.Text["op_replace"] + " ¶1: T → B",
+		i18n.Text["op_replace"] + " ¶1: T → R"}
+	assert.Equal(expect, alternativesPicker().window())
+
+	alternativesPicker().next()
+	assert.Equal(0, currentAlt)
+	assert.Equal(expect[:3], alternativesPicker().window())
+
+	alternativesPicker().prev()
+	assert.Equal(1, currentAlt)
+
+	alternativesPicker().prev()
+	RedoAlternative()
+	assert.Equal(None, Mode)
+	assert.Equal("Best", ps.GetText(1))
+	assert.Equal(1, cursor[Char])
+}
+
+func TestVersionsWindow(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(30, 10)
+	sep := strings.Repeat("—", 30)
+
+	assert.Equal([]string{sep, "● 0 " + i18n.Text["op_none"]}, versionsWindow())
+
+	ps.Init("I1,0:Test\nS1,4\nR1,0:T\tB\n1R1,0:T\tR\n")
+	ps.Undo()
+	expect := []string{sep, "○ 0 " + i18n.Text["op_none"], "○ 1 " + i18n.Text["op_insert"] + " ¶1: Test",
+		"● 2 " + i18n.Text["op_split"] + " ¶1", "├─ 3 " + i18n.Text["op_replace"] + " ¶1: T → B",
+		"└▸ 4 " + i18n.Text["op_replace"] + " ¶1: T → R"}
+	assert.Equal(expect, versionsWindow())
+
+	ResizeScreen(30, 7)
+	assert.Equal(append(expect[:1:1], expect[2:]...), versionsWindow())
+
+	ResizeScreen(30, 4)
+	assert.Equal([]string{sep, expect[3]}, versionsWindow())
+
+	ResizeScreen(30, 3)
+	assert.Equal(expect[3:4], versionsWindow())
+}
+
+func TestVersionsScreen(t *testing.T) {
+	assert := assert.New(t)
+	setupTest()
+	ResizeScreen(30, 6)
+	ps.Init("I1,0:Test\n")
+
+	Undo()
+	assert.Contains(Screen(), "● 0 "+i18n.Text["op_none"]+"\n└▸ 1 ")
+
+	Redo()
+	assert.Contains(Screen(), "○ 0 "+i18n.Text["op_none"]+"\n● 1 ")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	_ "embed"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/xanni/jotty/collab"
 	"github.com/xanni/jotty/edits"
 	"github.com/xanni/jotty/i18n"
 	ps "github.com/xanni/jotty/permascroll"
@@ -30,6 +32,22 @@ func cleanup() {
 	}
 }
 
+// Open the permascroll, reporting any recovery from damage in the editor.
+func open(path string, readOnly bool) {
+	open := ps.OpenPermascroll
+	if readOnly {
+		open = ps.OpenReadOnly
+	}
+
+	if err := open(path); errors.Is(err, ps.ErrRecovered) {
+		edits.SetMode(edits.Error, err.Error())
+	} else if errors.Is(err, ps.ErrLocked) {
+		log.Fatalf("%+v\n%s", err, i18n.Text["locked"])
+	} else if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
 func usage() {
 	fmt.Println("https://github.com/xanni/jotty  ⓒ 2024–2025 Andrew Pam <xanni@xanadu.net>")
 	fmt.Printf("\n"+i18n.Text["usage"]+"\n", filepath.Base(os.Args[0]), defaultPermascroll)
@@ -38,6 +56,14 @@ func usage() {
 
 func main() {
 	flag.Usage = usage
+	atTime := flag.String("at-time", "", i18n.Text["at-time"])
+	atVersion := flag.Int("at-version", -1, i18n.Text["at-version"])
+	fFlag := flag.Bool("follow", false, i18n.Text["follow"])
+	format := flag.String("format", "", i18n.Text["format"])
+	hFlag := flag.String("host", "", i18n.Text["host"])
+	jFlag := flag.String("join", "", i18n.Text["join"])
+	rFlag := flag.Bool("readonly", false, i18n.Text["readonly"])
+	replay := flag.Bool("replay", false, i18n.Text["replay"])
 	vFlag := flag.Bool("version", false, i18n.Text["version"])
 	flag.Parse()
 	if *vFlag {
@@ -45,8 +71,21 @@ func main() {
 		os.Exit(0)
 	}
 
+	switch flag.Arg(0) {
+	case "append":
+		os.Exit(appendText(flag.Args()[1:]))
+	case "cat":
+		os.Exit(cat(flag.Args()[1:], *format))
+	case "diff":
+		os.Exit(diff(flag.Args()[1:]))
+	case "fsck":
+		os.Exit(fsck(flag.Args()[1:]))
+	case "log":
+		os.Exit(showLog(flag.Args()[1:]))
+	}
+
 	exportPath, permascrollPath := defaultExport, defaultPermascroll
-	if len(os.Args) > 1 {
+	if flag.NArg() > 0 {
 		exportPath, permascrollPath = flag.Arg(0), flag.Arg(0)
 		if i := strings.LastIndex(exportPath, ".jot"); i >= 0 {
 			exportPath = exportPath[:i]
@@ -54,11 +93,54 @@ func main() {
 		exportPath += ".txt"
 	}
 
-	if err := ps.OpenPermascroll(permascrollPath); err != nil {
+	if err := ps.SetExportFormat(*format); err != nil {
 		log.Fatalf("%+v", err)
 	}
 
+	if *atTime != "" || *atVersion >= 0 {
+		os.Exit(exportAt(permascrollPath, exportPath, *format, *atVersion, *atTime))
+	}
+
+	shared := *hFlag != "" || *jFlag != ""
+	if shared && (*hFlag != "" && *jFlag != "" || *rFlag || *fFlag || *replay) {
+		log.Fatal(i18n.Text["session"])
+	}
+
+	var session collab.Session
+	if *jFlag != "" {
+		c, err := collab.Dial(ps.Default(), *jFlag)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		session = c
+	} else {
+		open(permascrollPath, *rFlag || *fFlag || *replay)
+	}
+
 	defer cleanup()
 
-	edits.Run(version, exportPath)
+	if *hFlag != "" {
+		h, err := collab.Listen(ps.Default(), *hFlag)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		session = h
+	}
+
+	if session != nil {
+		defer func() {
+			ps.Flush() // Send any pending operation before leaving
+			if err := session.Close(); err != nil {
+				log.Printf("%+v", err)
+			}
+		}()
+	}
+
+	if *replay {
+		edits.StartReplay()
+	}
+
+	edits.Run(version, exportPath, *fFlag, session)
 }
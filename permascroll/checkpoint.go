@@ -0,0 +1,225 @@
+package permascroll
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+/*
+Implements checkpoints that allow large permascrolls to be opened without
+replaying every operation from the beginning.
+
+A checkpoint is stored in a sidecar file next to the permascroll and records the
+complete state after replaying a prefix of the permascroll, together with the
+size and hash of that prefix.  When the permascroll is opened the prefix is
+hashed and compared, and only the operations following it are replayed.  If the
+checkpoint is missing, unreadable or does not match the permascroll then the
+entire permascroll is replayed as usual, so a checkpoint can always be safely
+deleted.
+*/
+
+const (
+	checkpointInterval = 1 << 20        // Minimum growth of the permascroll in bytes between checkpoints
+	checkpointMagic    = "JottyCheckV1" // Checkpoint format descriptor
+	checkpointSuffix   = ".idx"         // Appended to the permascroll path
+)
+
+// Serialised state of a permascroll.
+type checkpointType struct {
+	Magic         string
+	Size          int    // Size of the permascroll prefix
+	Hash          uint64 // Hash of the permascroll prefix
+	Current       int
+	CutText       []string
+	CutTime       []time.Time
+	Discarded     map[int][][5]int // Transclusions dropped by the operation of each version
+	Document      []string
+	HistDigest    []digest
+	HistHash      map[uint64][]int
+	HistTime      []time.Time
+	History       [][3]int // Source, parent and last child of each version
+	LastTime      time.Time
+	Links         []checkpointLink
+	Offset        int
+	Paragraph     int
+	Relinked      map[int][]checkpointLink // Links altered by the operation of each version
+	Transclusions [][5]int                 // Paragraph, beginning, end, origin and offset of each transclusion
+}
+
+// Serialised link, or the previous ends of a link altered by an operation.
+type checkpointLink struct {
+	N    int // Index of an altered link
+	Kind string
+	Ends [][3]int // Paragraph, beginning and end of each end of the link
+}
+
+// Convert serialised link ends.
+func decodeEnds(c [][3]int) (ends []linkEnd) {
+	for _, e := range c {
+		ends = append(ends, linkEnd{e[0], e[1], e[2]})
+	}
+
+	return ends
+}
+
+// Convert link ends for serialisation.
+func encodeEnds(ends []linkEnd) (c [][3]int) {
+	for _, e := range ends {
+		c = append(c, [3]int{e.pn, e.begin, e.end})
+	}
+
+	return c
+}
+
+// Convert serialised transclusions.
+func decodeTransclusions(c [][5]int) (trans []transclusion) {
+	for _, t := range c {
+		trans = append(trans, transclusion{t[0], t[1], t[2], t[3], t[4]})
+	}
+
+	return trans
+}
+
+// Convert transclusions for serialisation.
+func encodeTransclusions(trans []transclusion) (c [][5]int) {
+	for _, t := range trans {
+		c = append(c, [5]int{t.pn, t.begin, t.end, t.origin, t.offset})
+	}
+
+	return c
+}
+
+// Restore the state from a checkpoint, if it is valid for the permascroll.
+func (ps *Permascroll) loadCheckpoint(path string) bool {
+	f, err := os.Open(path + checkpointSuffix)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var c checkpointType
+	if gob.NewDecoder(f).Decode(&c) != nil || c.Magic != checkpointMagic || c.Size > len(ps.permascroll) ||
+		c.Size < len(magic) || !ps.parseMagic() || xxhash.Sum64(ps.permascroll[:c.Size]) != c.Hash ||
+		len(c.CutText) != len(c.CutTime) || len(c.History) != len(c.HistTime) ||
+		len(c.History) != len(c.HistDigest) || c.Current >= len(c.History) ||
+		len(c.Document) == 0 {
+		return false
+	}
+
+	ps.cut, ps.cutHash = make([]cutType, len(c.CutText)), map[uint64]int{}
+	for i, t := range c.CutText {
+		ps.cut[i] = cutType{t, c.CutTime[i]}
+		h := xxhash.Sum64String(t)
+		if _, found := ps.cutHash[h]; !found { // Otherwise the hash collided with that of an earlier cut
+			ps.cutHash[h] = i
+		}
+	}
+
+	ps.document, ps.docHash = c.Document, make([]uint64, len(c.Document))
+	for pn := range ps.document {
+		ps.updateHash(pn + 1)
+	}
+
+	ps.history = make([]version, len(c.History))
+	for i, v := range c.History {
+		ps.history[i] = version{v[0], v[1], v[2]}
+	}
+
+	ps.checkpoint, ps.current, ps.histDigest, ps.histHash, ps.histTime = c.Size, c.Current, c.HistDigest, c.HistHash,
+		c.HistTime
+	ps.lastTime, ps.offset, ps.paragraph = c.LastTime, c.Offset, c.Paragraph
+
+	ps.transclusions, ps.discarded = decodeTransclusions(c.Transclusions), map[int][]transclusion{}
+	for v, d := range c.Discarded {
+		ps.discarded[v] = decodeTransclusions(d)
+	}
+
+	ps.links, ps.relinked = nil, map[int][]relink{}
+	for _, l := range c.Links {
+		ps.links = append(ps.links, link{l.Kind, decodeEnds(l.Ends)})
+	}
+
+	for v, r := range c.Relinked {
+		for _, l := range r {
+			ps.relinked[v] = append(ps.relinked[v], relink{l.N, decodeEnds(l.Ends)})
+		}
+	}
+
+	return true
+}
+
+// Write a checkpoint if the permascroll has grown sufficiently since the last
+// one.
+func (ps *Permascroll) updateCheckpoint() error {
+	if len(ps.path) == 0 || len(ps.permascroll)-ps.checkpoint < checkpointInterval {
+		return nil
+	}
+
+	return ps.writeCheckpoint(ps.path)
+}
+
+// Write a checkpoint of the current state, replacing any previous checkpoint.
+func (ps *Permascroll) writeCheckpoint(path string) (err error) {
+	ps.Flush()
+	c := checkpointType{
+		Magic: checkpointMagic, Size: len(ps.permascroll), Hash: xxhash.Sum64(ps.permascroll),
+		Current: ps.current, Document: ps.document, HistDigest: ps.histDigest, HistHash: ps.histHash,
+		HistTime: ps.histTime,
+		LastTime: ps.lastTime, Offset: ps.offset, Paragraph: ps.paragraph,
+	}
+
+	for _, t := range ps.cut {
+		c.CutText, c.CutTime = append(c.CutText, t.text), append(c.CutTime, t.ts)
+	}
+
+	c.History = make([][3]int, len(ps.history))
+	for i, v := range ps.history {
+		c.History[i] = [3]int{v.source, v.parent, v.lastChild}
+	}
+
+	c.Transclusions, c.Discarded = encodeTransclusions(ps.transclusions), map[int][][5]int{}
+	for v, d := range ps.discarded {
+		c.Discarded[v] = encodeTransclusions(d)
+	}
+
+	for _, l := range ps.links {
+		c.Links = append(c.Links, checkpointLink{Kind: l.kind, Ends: encodeEnds(l.ends)})
+	}
+
+	c.Relinked = map[int][]checkpointLink{}
+	for v, r := range ps.relinked {
+		for _, l := range r {
+			c.Relinked[v] = append(c.Relinked[v], checkpointLink{N: l.n, Ends: encodeEnds(l.ends)})
+		}
+	}
+
+	// Write to a temporary file first so that a partial checkpoint is never seen
+	var f *os.File
+	if f, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+checkpointSuffix+"*"); err != nil {
+		return fmt.Errorf("failed checkpoint: %w", err)
+	}
+
+	if err = gob.NewEncoder(f).Encode(c); err == nil {
+		err = f.Close()
+	} else {
+		f.Close() // Ignore error; Encode error takes precedence
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path+checkpointSuffix)
+	}
+
+	if err != nil {
+		os.Remove(f.Name()) // Ignore error; the original error takes precedence
+		err = fmt.Errorf("failed checkpoint: %w", err)
+	} else {
+		ps.checkpoint = c.Size
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package permascroll
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	p := New(testHistory)
+	p.file = &mockFileType{}
+	p.CutText(1, 0, 1)
+	p.Transclude(1, 0, 1, 0, 2)
+	p.CreateLink("quote", LinkEnd{1, 0, 1}, LinkEnd{1, 2, 3})
+	p.ReplaceText(1, 2, 3, "X")
+	require.NoError(t, p.writeCheckpoint(path))
+	assert.Equal(len(p.permascroll), p.checkpoint)
+
+	q := New("")
+	q.permascroll = p.permascroll
+	assert.True(q.loadCheckpoint(path))
+	assert.Equal(p.document, q.document)
+	assert.Equal(p.docHash, q.docHash)
+	assert.Equal(p.cut, q.cut)
+	assert.Equal(p.cutHash, q.cutHash)
+	assert.Equal(p.history, q.history)
+	assert.Equal(p.histHash, q.histHash)
+	assert.Equal(p.histDigest, q.histDigest)
+	assert.Equal(p.histTime, q.histTime)
+	assert.Equal(p.current, q.current)
+	assert.Equal(p.transclusions, q.transclusions)
+	assert.Equal(p.discarded, q.discarded)
+	assert.Equal(p.links, q.links)
+	assert.Equal(p.relinked, q.relinked)
+
+	t.Run("mismatch", func(_ *testing.T) {
+		q := New("")
+		q.permascroll = []byte(magic + "I1,0:Other\n")
+		assert.False(q.loadCheckpoint(path))
+	})
+
+	t.Run("corrupt", func(_ *testing.T) {
+		require.NoError(t, os.WriteFile(path+".bad"+checkpointSuffix, []byte("garbage"), 0o600))
+		q := New("")
+		q.permascroll = p.permascroll
+		assert.False(q.loadCheckpoint(path + ".bad"))
+		assert.False(q.loadCheckpoint(path + ".missing"))
+	})
+
+	t.Run("failure", func(_ *testing.T) {
+		require.ErrorContains(t, p.writeCheckpoint(filepath.Join(path, "missing", "test.jot")), "failed checkpoint: ")
+	})
+}
+
+func TestOpenCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	p := New(testHistory)
+	p.file = &mockFileType{}
+	require.NoError(t, p.writeCheckpoint(path))
+	p.InsertText(1, 0, "More ")
+	p.Flush()
+	require.NoError(t, os.WriteFile(path, p.permascroll, 0o600))
+
+	q := New("")
+	require.NoError(t, q.OpenPermascroll(path))
+	assert.Equal(len(testHistory)+len(magic), q.checkpoint)
+	assert.Equal([]string{"More st"}, q.document)
+	assert.Equal(p.history, q.history)
+	assert.Equal(p.current, q.current)
+	require.NoError(t, q.ClosePermascroll())
+
+	// A checkpoint that does not match the permascroll is ignored
+	require.NoError(t, os.WriteFile(path, []byte(magic+"I1,0:New\n"), 0o600))
+	q = New("")
+	require.NoError(t, q.OpenPermascroll(path))
+	assert.Zero(q.checkpoint)
+	assert.Equal([]string{"New"}, q.document)
+}
+
+func TestSyncCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	p := New(testHistory)
+	p.file, p.path = &mockFileType{}, path
+	require.NoError(t, p.SyncPermascroll())
+	assert.NoFileExists(path+checkpointSuffix, "not grown sufficiently")
+
+	p.checkpoint = len(p.permascroll) - checkpointInterval
+	require.NoError(t, p.SyncPermascroll())
+	assert.FileExists(path + checkpointSuffix)
+	assert.Equal(len(p.permascroll), p.checkpoint)
+}
@@ -0,0 +1,164 @@
+package permascroll
+
+import (
+	"io"
+	"time"
+)
+
+/*
+The package-level functions below operate on a default permascroll, so that
+programs editing a single document do not need to manage a Permascroll of their
+own.
+*/
+
+var std = New("")
+
+// Initialise the default permascroll.
+func Init(p string) { std.Init(p) }
+
+// Append text to the end of the document as new paragraphs.
+func AppendParagraphs(text string) error { return std.AppendParagraphs(text) }
+
+// Append text to a paragraph.
+func AppendText(pn int, text string) { std.AppendText(pn, text) }
+
+// Close the permascroll file.
+func ClosePermascroll() error { return std.ClosePermascroll() }
+
+// Copy text from a paragraph between pos and end.  Returns cut number.
+func CopyText(pn, pos, end int) int { return std.CopyText(pn, pos, end) }
+
+// Copy text between pos in paragraph pn and end in paragraph epn.  Returns cut number.
+func CopySpan(pn, pos, epn, end int) int { return std.CopySpan(pn, pos, epn, end) }
+
+// Create a link of the specified type between two or more spans of text.
+func CreateLink(kind string, ends ...LinkEnd) { std.CreateLink(kind, ends...) }
+
+// Number of cuts in the document.
+func Cuts() int { return std.Cuts() }
+
+// The current version of the document.
+func CurrentVersion() int { return std.CurrentVersion() }
+
+// Cut text from a paragraph between pos and end.  Returns cut number.
+func CutText(pn, pos, end int) int { return std.CutText(pn, pos, end) }
+
+// Cut text between pos in paragraph pn and end in paragraph epn.  Returns cut number.
+func CutSpan(pn, pos, epn, end int) int { return std.CutSpan(pn, pos, epn, end) }
+
+// The default permascroll, for packages that operate on a Permascroll.
+func Default() *Permascroll { return std }
+
+// Delete text from a paragraph between pos and end.
+func DeleteText(pn, pos, end int) { std.DeleteText(pn, pos, end) }
+
+// Compare the document at version v1 with the document at version v2.
+func Diff(v1, v2 int) []ParagraphDiff { return std.Diff(v1, v2) }
+
+// Exchange two paragraphs.
+func ExchangeParagraphs(pn int) { std.ExchangeParagraphs(pn) }
+
+// Exchange two text spans.
+func ExchangeText(pn, b1, e1, b2, e2 int) { std.ExchangeText(pn, b1, e1, b2, e2) }
+
+// Export text between pos in paragraph pn and end in paragraph epn.
+func ExportSpan(path string, pn, pos, epn, end int) error {
+	return std.ExportSpan(path, pn, pos, epn, end)
+}
+
+// Export entire document or text from a paragraph between pos and end.
+func ExportText(path string, pn, pos, end int) error { return std.ExportText(path, pn, pos, end) }
+
+// Write pending insertion or deletion to permascroll.
+// Safe to use concurrently.
+func Flush() { std.Flush() }
+
+// Replay records appended to a read-only permascroll file by another process.
+func FollowPermascroll() (bool, error) { return std.FollowPermascroll() }
+
+// Get a cut from the document.
+func GetCut(n int) (string, time.Time) { return std.GetCut(n) }
+
+// Get information about a version of the document.
+func GetVersion(v int) VersionInfo { return std.GetVersion(v) }
+
+// Get the current position in the document.
+func GetPos() (p int, o int) { return std.GetPos() }
+
+// Get the size of a paragraph.
+func GetSize(pn int) int { return std.GetSize(pn) }
+
+// Get the text of a paragraph.
+func GetText(pn int) string { return std.GetText(pn) }
+
+// Move the document to any version in the history.
+func GotoVersion(v int) { std.GotoVersion(v) }
+
+// Import a UTF-8 text file into a paragraph at pos as a single insertion.
+func ImportText(path string, pn, pos int) error { return std.ImportText(path, pn, pos) }
+
+// Insert text into a paragraph at pos.
+func InsertText(pn int, pos int, text string) { std.InsertText(pn, pos, text) }
+
+// The links with at least one end in a paragraph, in the order they were created.
+func Links(pn int) []Link { return std.Links(pn) }
+
+// Merge two paragraphs.
+func MergeParagraph(pn int) { std.MergeParagraph(pn) }
+
+// Move count paragraphs starting from pn so that the first of them becomes paragraph dest.
+func MoveParagraphs(pn, count, dest int) { std.MoveParagraphs(pn, count, dest) }
+
+// Open or create a permascroll file.
+func OpenPermascroll(path string) error { return std.OpenPermascroll(path) }
+
+// Open a permascroll file without locking it or writing to it.
+func OpenReadOnly(path string) error { return std.OpenReadOnly(path) }
+
+// Number of paragraphs in the document.
+func Paragraphs() int { return std.Paragraphs() }
+
+// Path of the permascroll file, or empty if it is not stored in a file.
+func Path() string { return std.Path() }
+
+// Versions whose operation inserted primedia that can be transcluded, oldest first.
+func Primedia() []int { return std.Primedia() }
+
+// True if the permascroll was opened read-only.
+func ReadOnly() bool { return std.ReadOnly() }
+
+// Redo the last undone operation, if any.
+func Redo() byte { return std.Redo() }
+
+// Replace text in a paragraph between pos and end.
+func ReplaceText(pn, pos, end int, text string) { std.ReplaceText(pn, pos, end, text) }
+
+// True if operations can span paragraphs.
+func SpansParagraphs() bool { return std.SpansParagraphs() }
+
+// Select the format for every export, or choose it by file extension if empty.
+func SetExportFormat(format string) error { return std.SetExportFormat(format) }
+
+// Split a paragraph at a specified position.
+func SplitParagraph(pn, pos int) { std.SplitParagraph(pn, pos) }
+
+// Ensure the permascroll backing store is written to stable storage.
+func SyncPermascroll() error { return std.SyncPermascroll() }
+
+// Transclude the primedia of version v between offset and end into a paragraph at pos.
+func Transclude(pn, pos, v, offset, end int) { std.Transclude(pn, pos, v, offset, end) }
+
+// The transcluded text within a paragraph in order of position.
+func Transclusions(pn int) []Transclusion { return std.Transclusions(pn) }
+
+// Undo the immediately preceding operation, if any.
+func Undo() byte { return std.Undo() }
+
+// The version created most recently at or before time t.
+func VersionAt(t time.Time) int { return std.VersionAt(t) }
+
+// Number of versions of the document, including the initial empty version 0.
+func Versions() int { return std.Versions() }
+
+// Write the entire document in the selected export format.
+func WriteText(w io.Writer) error { return std.WriteText(w) }
@@ -0,0 +1,317 @@
+package permascroll
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+/*
+Implements comparison of the document at two versions.  Paragraphs are
+compared first, and the paragraphs in each run of changes are paired with the
+paragraphs that replaced them by the words they have in common.  The sentences
+of each pair of paragraphs are then compared in the same way, and finally the
+words of each pair of sentences, so that changes are reported as whole words,
+sentences and paragraphs.  Sentences and words are segmented in the same way as
+the editor, according to Unicode Standard Annex #29 as implemented in the
+"uniseg" module.
+*/
+
+// Kinds of change between two versions.
+const (
+	Unchanged = '='
+	Deleted   = '-'
+	Inserted  = '+'
+)
+
+// A run of text that was unchanged, deleted or inserted.
+type Change struct {
+	Kind byte   // Unchanged, Deleted or Inserted
+	Text string // Text of the run
+}
+
+// The changes to a paragraph between two versions.
+type ParagraphDiff struct {
+	Old, New int      // Paragraph numbers in each version, or 0 if it is absent
+	Changes  []Change // Runs of text making up the paragraph
+}
+
+// True if any of the paragraph changed.
+func (d ParagraphDiff) Changed() bool {
+	return len(d.Changes) != 1 || d.Changes[0].Kind != Unchanged
+}
+
+// Append a change, merging it with the last change if it is of the same kind.
+func appendChange(changes []Change, kind byte, text string) []Change {
+	if len(text) == 0 {
+		return changes
+	}
+
+	if n := len(changes); n > 0 && changes[n-1].Kind == kind {
+		changes[n-1].Text += text
+
+		return changes
+	}
+
+	return append(changes, Change{kind, text})
+}
+
+/*
+The edit script transforming a into b, as a sequence of Unchanged, Deleted and
+Inserted kinds with the index of the element of a or b that each refers to.  The
+common prefix and suffix are trimmed before computing the longest common
+subsequence of the remainder.
+*/
+func diffSequence(a, b []string) (kinds []byte, indices []int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for i := range prefix {
+		kinds, indices = append(kinds, Unchanged), append(indices, i)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			kinds, indices = append(kinds, Unchanged), append(indices, prefix+i)
+			i++
+			j++
+		case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			kinds, indices = append(kinds, Deleted), append(indices, prefix+i)
+			i++
+		default:
+			kinds, indices = append(kinds, Inserted), append(indices, prefix+j)
+			j++
+		}
+	}
+
+	for i := range suffix {
+		kinds, indices = append(kinds, Unchanged), append(indices, len(a)-suffix+i)
+	}
+
+	return kinds, indices
+}
+
+// Compare two sequences of segments, calling same for each unchanged segment and
+// change for each run of deleted and inserted segments.
+func diffRuns(a, b []string, same func(s string), change func(deleted, inserted []string)) {
+	kinds, indices := diffSequence(a, b)
+	var deleted, inserted []string
+	for n, kind := range kinds {
+		switch kind {
+		case Deleted:
+			deleted = append(deleted, a[indices[n]])
+		case Inserted:
+			inserted = append(inserted, b[indices[n]])
+		default:
+			if len(deleted) > 0 || len(inserted) > 0 {
+				change(deleted, inserted)
+				deleted, inserted = nil, nil
+			}
+			same(a[indices[n]])
+		}
+	}
+
+	if len(deleted) > 0 || len(inserted) > 0 {
+		change(deleted, inserted)
+	}
+}
+
+// Split text into sentences.
+func sentences(s string) (t []string) {
+	state := -1
+	var sentence string
+	for len(s) > 0 {
+		sentence, s, state = uniseg.FirstSentenceInString(s, state)
+		t = append(t, sentence)
+	}
+
+	return t
+}
+
+// Split text into words and the spaces and punctuation between them.
+func words(s string) (t []string) {
+	state := -1
+	var word string
+	for len(s) > 0 {
+		word, s, state = uniseg.FirstWordInString(s, state)
+		t = append(t, word)
+	}
+
+	return t
+}
+
+// Number of words in common between two segments, ignoring spaces and
+// punctuation.
+func commonWords(a, b string) (n int) {
+	count := make(map[string]int)
+	for _, w := range words(a) {
+		if strings.IndexFunc(w, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			count[w]++
+		}
+	}
+
+	for _, w := range words(b) {
+		if count[w] > 0 {
+			count[w]--
+			n++
+		}
+	}
+
+	return n
+}
+
+/*
+Pair the deleted and inserted segments of a run of changes, preserving their
+order and maximising the number of words in common between the pairs.  Calls
+pair for each deleted or inserted segment in order, with -1 for the index of
+the segment that it is not paired with.  Segments with no words in common are
+not paired unless the run replaces a single segment with a single segment.
+*/
+func pairRun(deleted, inserted []string, pair func(d, i int)) {
+	if len(deleted) == 1 && len(inserted) == 1 {
+		pair(0, 0)
+
+		return
+	}
+
+	// score[d][i] is the most words in common when pairing deleted[d:] with inserted[i:]
+	score := make([][]int, len(deleted)+1)
+	for d := range score {
+		score[d] = make([]int, len(inserted)+1)
+	}
+
+	common := func(d, i int) int { return commonWords(deleted[d], inserted[i]) }
+	for d := len(deleted) - 1; d >= 0; d-- {
+		for i := len(inserted) - 1; i >= 0; i-- {
+			score[d][i] = max(score[d+1][i], score[d][i+1])
+			if c := common(d, i); c > 0 {
+				score[d][i] = max(score[d][i], score[d+1][i+1]+c)
+			}
+		}
+	}
+
+	d, i := 0, 0
+	for d < len(deleted) || i < len(inserted) {
+		switch {
+		case d == len(deleted):
+			pair(-1, i)
+			i++
+		case i == len(inserted) || score[d][i] == score[d+1][i]:
+			pair(d, -1)
+			d++
+		case score[d][i] == score[d][i+1]:
+			pair(-1, i)
+			i++
+		default:
+			pair(d, i)
+			d++
+			i++
+		}
+	}
+}
+
+// The changes between two versions of a paragraph, by sentence and by word.
+func diffText(before, after string) (changes []Change) {
+	diffRuns(sentences(before), sentences(after), func(s string) {
+		changes = appendChange(changes, Unchanged, s)
+	}, func(deleted, inserted []string) {
+		pairRun(deleted, inserted, func(d, i int) {
+			switch {
+			case i < 0:
+				changes = appendChange(changes, Deleted, deleted[d])
+			case d < 0:
+				changes = appendChange(changes, Inserted, inserted[i])
+			default:
+				diffRuns(words(deleted[d]), words(inserted[i]), func(w string) {
+					changes = appendChange(changes, Unchanged, w)
+				}, func(dw, iw []string) {
+					changes = appendChange(changes, Deleted, strings.Join(dw, ""))
+					changes = appendChange(changes, Inserted, strings.Join(iw, ""))
+				})
+			}
+		})
+	})
+
+	return changes
+}
+
+// The paragraphs of the document at version v, restoring the current version
+// and the branches that Redo follows.
+func (ps *Permascroll) documentAt(v int) []string {
+	ps.validateVersion(v)
+	ps.Flush()
+	current, pn, offset := ps.current, ps.paragraph, ps.offset
+	lastChild := make(map[int]int) // Of every version that GotoVersion may redo from
+	for _, a := range []int{v, current} {
+		for ; a > 0; a = ps.history[a].parent {
+			parent := ps.history[a].parent
+			lastChild[parent] = ps.history[parent].lastChild
+		}
+	}
+
+	ps.GotoVersion(v)
+	document := slices.Clone(ps.document)
+	ps.GotoVersion(current)
+	ps.paragraph, ps.offset = pn, offset
+	for parent, child := range lastChild {
+		ps.history[parent].lastChild = child
+	}
+
+	return document
+}
+
+// Compare the document at version v1 with the document at version v2.
+func (ps *Permascroll) Diff(v1, v2 int) (d []ParagraphDiff) {
+	a, b := ps.documentAt(v1), ps.documentAt(v2)
+	pa, pb := 1, 1 // Paragraph numbers in each version
+	diffRuns(a, b, func(p string) {
+		d = append(d, ParagraphDiff{pa, pb, []Change{{Unchanged, p}}})
+		pa++
+		pb++
+	}, func(deleted, inserted []string) {
+		pairRun(deleted, inserted, func(dp, ip int) {
+			switch {
+			case ip < 0:
+				d = append(d, ParagraphDiff{pa, 0, []Change{{Deleted, deleted[dp]}}})
+				pa++
+			case dp < 0:
+				d = append(d, ParagraphDiff{0, pb, []Change{{Inserted, inserted[ip]}}})
+				pb++
+			default:
+				d = append(d, ParagraphDiff{pa, pb, diffText(deleted[dp], inserted[ip])})
+				pa++
+				pb++
+			}
+		})
+	})
+
+	return d
+}
@@ -0,0 +1,88 @@
+package permascroll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSequence(t *testing.T) {
+	tests := map[string]struct {
+		a, b    []string
+		kinds   string
+		indices []int
+	}{
+		"Empty":     {nil, nil, "", nil},
+		"Same":      {[]string{"a", "b"}, []string{"a", "b"}, "==", []int{0, 1}},
+		"Insert":    {[]string{"a", "c"}, []string{"a", "b", "c"}, "=+=", []int{0, 1, 1}},
+		"Delete":    {[]string{"a", "b", "c"}, []string{"a", "c"}, "=-=", []int{0, 1, 2}},
+		"Replace":   {[]string{"a", "b", "c"}, []string{"a", "x", "c"}, "=-+=", []int{0, 1, 1, 2}},
+		"Reordered": {[]string{"a", "b", "c"}, []string{"c", "a", "b"}, "+==-", []int{0, 0, 1, 2}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kinds, indices := diffSequence(tc.a, tc.b)
+			assert.Equal(t, tc.kinds, string(kinds))
+			assert.Equal(t, tc.indices, indices)
+		})
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	tests := map[string]struct {
+		before, after string
+		changes       []Change
+	}{
+		"Word": {"One two three.", "One four three.",
+			[]Change{{Unchanged, "One "}, {Deleted, "two"}, {Inserted, "four"}, {Unchanged, " three."}}},
+		"Sentence": {"One. Two.", "One. Two. Three.",
+			[]Change{{Unchanged, "One. Two."}, {Inserted, " Three."}}},
+		"Sentences": {"One. Two. Three.", "One. Four. Five. Three.",
+			[]Change{{Unchanged, "One. "}, {Deleted, "Two. "}, {Inserted, "Four. Five. "}, {Unchanged, "Three."}}},
+		"Paired sentence": {"One. Two. Three.", "One. Four. Two too. Three.",
+			[]Change{{Unchanged, "One. "}, {Inserted, "Four. "}, {Unchanged, "Two"}, {Inserted, " too"},
+				{Unchanged, ". Three."}}},
+		"Unchanged sentence": {"One two. Three.", "One three. Three.",
+			[]Change{{Unchanged, "One "}, {Deleted, "two"}, {Inserted, "three"}, {Unchanged, ". Three."}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.changes, diffText(tc.before, tc.after))
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	ps := New("I1,0:One two.\nS1,8\nI2,0:Three.\nS2,6\nI3,0:Four.\n")
+	ps.file = &mockFileType{}
+	ps.DeleteText(2, 0, 6)
+	ps.MergeParagraph(2)
+	ps.InsertText(1, 4, "and ")
+	ps.AppendText(2, " Five.")
+	ps.Flush()
+	assert.Equal([]string{"One and two.", "Four. Five."}, ps.document)
+
+	d := ps.Diff(5, ps.CurrentVersion())
+	assert.Equal([]ParagraphDiff{
+		{1, 1, []Change{{Unchanged, "One "}, {Inserted, "and "}, {Unchanged, "two."}}},
+		{2, 0, []Change{{Deleted, "Three."}}},
+		{3, 2, []Change{{Unchanged, "Four."}, {Inserted, " Five."}}},
+	}, d)
+	assert.True(d[0].Changed())
+
+	d = ps.Diff(2, 2)
+	assert.Equal([]ParagraphDiff{{1, 1, []Change{{Unchanged, "One two."}}}, {2, 2, []Change{{Unchanged, ""}}}}, d)
+	assert.False(d[0].Changed())
+	assert.Equal(9, ps.CurrentVersion(), "current version retained")
+
+	ps.Undo()
+	ps.InsertText(1, 0, "Zero ")
+	ps.Flush()
+	ps.Undo()
+	ps.Diff(9, ps.CurrentVersion())
+	ps.Redo()
+	assert.Equal(10, ps.CurrentVersion(), "redo branch retained")
+}
@@ -0,0 +1,195 @@
+package permascroll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+/*
+Implements the formats for exporting text.  Each format is written by an
+Exporter registered under the file extension that it is usually saved with.
+The format of an export is chosen by the extension of the path it is written
+to, unless a format has been selected for every export, and text is exported as
+plain paragraphs separated by blank lines if the extension is not registered.
+*/
+
+// A paragraph of exported text.
+type Paragraph struct {
+	Number int    // Paragraph number in the document
+	Text   string // Text exported from the paragraph, which may be only part of it
+	Hash   uint64 // Hash of the exported text
+}
+
+// Write paragraphs exported from a version of the document in some format.
+type Exporter func(w io.Writer, version int, paragraphs []Paragraph) error
+
+var errFormat = errors.New("unknown export format")
+
+var exporters = map[string]Exporter{
+	"htm":  exportHTML,
+	"html": exportHTML,
+	"json": exportJSON,
+	"md":   exportMarkdown,
+	"txt":  exportPlain,
+}
+
+// Characters that Markdown would otherwise interpret, except for the "*" used
+// for emphasis, and the markers that start a heading or list.
+var (
+	markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`)
+	markdownBlock   = regexp.MustCompile(`^(#|[-+*] |\d+[.)] )`)
+)
+
+// Register an exporter for a format, replacing any existing exporter.  The
+// format is the file extension without the leading dot.
+func RegisterExporter(format string, e Exporter) { exporters[format] = e }
+
+// Select the format for every export, or choose the format by the file
+// extension if it is empty.
+func (ps *Permascroll) SetExportFormat(format string) error {
+	if _, ok := exporters[format]; format != "" && !ok {
+		return fmt.Errorf("format %q: %w", format, errFormat)
+	}
+
+	ps.format = format
+
+	return nil
+}
+
+// The exporter for a path.
+func (ps *Permascroll) exporter(path string) Exporter {
+	format := ps.format
+	if format == "" {
+		format = strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	}
+
+	if e, ok := exporters[format]; ok {
+		return e
+	}
+
+	return exportPlain
+}
+
+// Export paragraphs of the current version in the format for the path.
+func (ps *Permascroll) export(path string, paragraphs []Paragraph) (err error) {
+	var f FileInterface
+	if f, err = of.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644); err != nil {
+		return fmt.Errorf("failed export: %w", err)
+	}
+	defer f.Close() // Ignore error; Write error takes precedence
+
+	return ps.write(f, ps.exporter(path), paragraphs)
+}
+
+// Write paragraphs of the current version with an exporter.
+func (ps *Permascroll) write(w io.Writer, e Exporter, paragraphs []Paragraph) (err error) {
+	for i := range paragraphs {
+		paragraphs[i].Hash = xxhash.Sum64String(paragraphs[i].Text)
+	}
+
+	if err = e(w, ps.current, paragraphs); err != nil {
+		err = fmt.Errorf("failed export: %w", err)
+	}
+
+	return err
+}
+
+// Write the entire document to w in the selected export format, or as plain
+// text if no format has been selected.
+func (ps *Permascroll) WriteText(w io.Writer) error {
+	ps.Flush()
+	paragraphs := make([]Paragraph, len(ps.document))
+	for i, t := range ps.document {
+		paragraphs[i] = Paragraph{Number: i + 1, Text: t}
+	}
+
+	return ps.write(w, ps.exporter(""), paragraphs)
+}
+
+// Write paragraphs as HTML paragraph elements.
+func exportHTML(w io.Writer, _ int, paragraphs []Paragraph) (err error) {
+	if _, err = io.WriteString(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"></head>\n<body>\n"); err != nil {
+		return err // nolint:wrapcheck
+	}
+
+	for _, p := range paragraphs {
+		if _, err = io.WriteString(w, "<p>"+html.EscapeString(p.Text)+"</p>\n"); err != nil {
+			return err // nolint:wrapcheck
+		}
+	}
+
+	_, err = io.WriteString(w, "</body>\n</html>\n")
+
+	return err // nolint:wrapcheck
+}
+
+// Write paragraphs as a JSON object with the version of the document and the
+// number, text and hash of each paragraph.
+func exportJSON(w io.Writer, version int, paragraphs []Paragraph) error {
+	type paragraph struct {
+		Number int    `json:"paragraph"`
+		Text   string `json:"text"`
+		Hash   string `json:"hash"`
+	}
+
+	doc := struct {
+		Version    int         `json:"version"`
+		Paragraphs []paragraph `json:"paragraphs"`
+	}{version, make([]paragraph, len(paragraphs))}
+	for i, p := range paragraphs {
+		doc.Paragraphs[i] = paragraph{p.Number, p.Text, fmt.Sprintf("%016x", p.Hash)}
+	}
+
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+
+	return e.Encode(doc) // nolint:wrapcheck
+}
+
+// Write paragraphs as Markdown separated by blank lines, escaping everything
+// that Markdown would interpret except for "*" and "**" emphasis.
+func exportMarkdown(w io.Writer, version int, paragraphs []Paragraph) error {
+	escaped := make([]Paragraph, len(paragraphs))
+	for i, p := range paragraphs {
+		p.Text = markdownEscaper.Replace(p.Text)
+		switch m := markdownBlock.FindString(p.Text); {
+		case m == "":
+		case m[0] >= '0' && m[0] <= '9': // Ordered list item
+			p.Text = p.Text[:len(m)-2] + `\` + p.Text[len(m)-2:]
+		default: // Heading or unordered list item
+			p.Text = `\` + p.Text
+		}
+		escaped[i] = p
+	}
+
+	return exportPlain(w, version, escaped)
+}
+
+// Write paragraphs as plain text separated by blank lines.
+func exportPlain(w io.Writer, _ int, paragraphs []Paragraph) (err error) {
+	for i, p := range paragraphs {
+		if i > 0 {
+			_, err = io.WriteString(w, "\n")
+		}
+
+		if err == nil {
+			_, err = io.WriteString(w, p.Text+"\n")
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	return err // nolint:wrapcheck
+}
@@ -0,0 +1,87 @@
+package permascroll
+
+import (
+	"io"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFormats(t *testing.T) {
+	tests := map[string]struct{ path, format, expect string }{
+		"Plain":    {"a.txt", "", "*One* & <two>\n\n# Three_\n"},
+		"Other":    {"a", "", "*One* & <two>\n\n# Three_\n"},
+		"Markdown": {"a.md", "", "*One* & \\<two\\>\n\n\\# Three\\_\n"},
+		"HTML": {"a.HTML", "", "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"></head>\n<body>\n" +
+			"<p>*One* &amp; &lt;two&gt;</p>\n<p># Three_</p>\n</body>\n</html>\n"},
+		"JSON": {"a.json", "", `{
+  "version": 0,
+  "paragraphs": [
+    {
+      "paragraph": 1,
+      "text": "*One* & <two>",
+      "hash": "a53c0b6d7b11388d"
+    },
+    {
+      "paragraph": 2,
+      "text": "# Three_",
+      "hash": "ba14ed0b8e2844f9"
+    }
+  ]
+}
+`},
+		"Selected": {"a.txt", "md", "*One* & \\<two\\>\n\n\\# Three\\_\n"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := New("")
+			p.document = []string{"*One* & <two>", "# Three_"}
+			require.NoError(t, p.SetExportFormat(tc.format))
+			mockFile = &mockFileType{}
+			require.NoError(t, p.ExportText(tc.path, 0, 0, 0))
+			assert.Equal(t, tc.expect, mockFile.contents)
+		})
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	tests := map[string]struct{ text, expect string }{
+		"Emphasis":  {"**Bold** and *italic*", "**Bold** and *italic*"},
+		"Code":      {"`code`", "\\`code\\`"},
+		"Link":      {"[a](b)", "\\[a\\](b)"},
+		"Unordered": {"- item", "\\- item"},
+		"Asterisk":  {"* item", "\\* item"},
+		"Ordered":   {"12. item", "12\\. item"},
+		"Number":    {"12.5 items", "12.5 items"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockFile = &mockFileType{}
+			require.NoError(t, exportMarkdown(mockFile, 0, []Paragraph{{Text: tc.text}}))
+			assert.Equal(t, tc.expect+"\n", mockFile.contents)
+		})
+	}
+}
+
+func TestExportSpanFormat(t *testing.T) {
+	assert := assert.New(t)
+	p := New("I1,0:One\nS1,3\nI2,0:Two\nS2,3\nI3,0:Three\n")
+	var exported []Paragraph
+	RegisterExporter("test", func(_ io.Writer, version int, paragraphs []Paragraph) error {
+		assert.Equal(5, version)
+		exported = paragraphs
+
+		return nil
+	})
+	defer delete(exporters, "test")
+
+	require.NoError(t, p.ExportSpan("a.test", 1, 1, 3, 2))
+	assert.Equal([]Paragraph{{1, "ne", xxhash.Sum64String("ne")}, {2, "Two", p.docHash[1]}, {3, "Th", xxhash.Sum64String("Th")}},
+		exported)
+
+	require.ErrorContains(t, p.SetExportFormat("doc"), `format "doc": unknown export format`)
+}
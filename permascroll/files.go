@@ -1,11 +1,16 @@
 package permascroll
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type FileInterface interface {
@@ -24,105 +29,416 @@ func (o defaultOpener) OpenFile(name string, flag int, perms fs.FileMode) (f Fil
 	return os.OpenFile(name, flag, perms) // nolint:wrapcheck
 }
 
-var (
-	of   opener        = defaultOpener{}
-	file FileInterface // Permascroll backing storage
-)
+var of opener = defaultOpener{}
+
+const corruptSuffix = ".corrupt" // Appended to the permascroll path for a damaged tail
 
 // Close the permascroll file.
-func ClosePermascroll() (err error) {
-	if err = file.Close(); err != nil {
-		err = fmt.Errorf("failed to close permascroll: %w", err)
+// A checkpoint is written if the permascroll has grown sufficiently.
+func (ps *Permascroll) ClosePermascroll() (err error) {
+	defer ps.unlockPermascroll()
+	if ps.readOnly {
+		return nil
+	}
+
+	err = ps.updateCheckpoint()
+
+	if cerr := ps.file.Close(); cerr != nil {
+		err = fmt.Errorf("failed to close permascroll: %w", cerr)
 	}
 
 	return err
 }
 
-// Export entire document or text from a paragraph between pos and end.
-func ExportText(path string, pn, pos, end int) (err error) {
-	if pn > 0 {
-		validateSpan(pn, pos, end)
+// Export text between pos in paragraph pn and end in paragraph epn.
+func (ps *Permascroll) ExportSpan(path string, pn, pos, epn, end int) error {
+	if epn == pn {
+		return ps.ExportText(path, pn, pos, end)
+	}
+
+	ps.validateRange(pn, pos, epn, end)
+	ps.Flush()
+	paragraphs := []Paragraph{{Number: pn, Text: ps.document[pn-1][pos:]}}
+	for p := pn + 1; p < epn; p++ {
+		paragraphs = append(paragraphs, Paragraph{Number: p, Text: ps.document[p-1]})
 	}
+	paragraphs = append(paragraphs, Paragraph{Number: epn, Text: ps.document[epn-1][:end]})
+
+	return ps.export(path, paragraphs)
+}
 
-	var f FileInterface
-	if f, err = of.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644); err != nil {
-		return fmt.Errorf("failed export: %w", err)
+// Export entire document or text from a paragraph between pos and end.
+func (ps *Permascroll) ExportText(path string, pn, pos, end int) error {
+	if pn > 0 {
+		ps.validateSpan(pn, pos, end)
 	}
-	defer f.Close() // Ignore error; WriteString error takes precedence
 
-	Flush()
+	ps.Flush()
+	var paragraphs []Paragraph
 	if pn > 0 {
-		_, err = f.WriteString(document[pn-1][pos:end] + "\n")
+		paragraphs = []Paragraph{{Number: pn, Text: ps.document[pn-1][pos:end]}}
 	} else {
-		for i, t := range document {
-			if i > 0 {
-				_, err = f.WriteString("\n")
-			}
+		for i, t := range ps.document {
+			paragraphs = append(paragraphs, Paragraph{Number: i + 1, Text: t})
+		}
+	}
 
-			if err == nil {
-				_, err = f.WriteString(t + "\n")
-			}
+	return ps.export(path, paragraphs)
+}
 
-			if err != nil {
-				break
-			}
+// Convert the contents of a text file to paragraphs separated by newlines.
+// Paragraphs in the file are separated by blank lines and the lines within each
+// paragraph are joined with spaces.
+func importParagraphs(text string) string {
+	var paras, lines []string
+	for _, l := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if l = strings.TrimSpace(l); len(l) > 0 {
+			lines = append(lines, l)
+		} else if len(lines) > 0 {
+			paras, lines = append(paras, strings.Join(lines, " ")), nil
+		}
+	}
+
+	if len(lines) > 0 {
+		paras = append(paras, strings.Join(lines, " "))
+	}
+
+	return strings.Join(paras, "\n")
+}
+
+// Import a UTF-8 text file into a paragraph at pos as a single insertion.  The
+// position afterwards is the end of the imported text.
+func (ps *Permascroll) ImportText(path string, pn, pos int) (err error) {
+	ps.validatePos(pn, pos)
+
+	var b []byte
+	if b, err = os.ReadFile(path); err != nil {
+		return fmt.Errorf("failed import: %w", err)
+	}
+
+	if !utf8.Valid(b) {
+		return fmt.Errorf("failed import: %w", errEncoding)
+	}
+
+	text := importParagraphs(string(b))
+	if ps.legacy && strings.Contains(text, "\n") {
+		return fmt.Errorf("failed import: paragraph break %w", errLegacy)
+	}
+
+	if len(text) > 0 {
+		ps.Flush()
+		ps.InsertText(pn, pos, text)
+		ps.Flush()
+	}
+
+	return nil
+}
+
+/*
+Append UTF-8 text to the end of the document as new paragraphs.  Paragraphs in
+the text are separated by blank lines and the lines within each paragraph are
+joined with spaces, as for ImportText.  An empty document receives the first
+paragraph; otherwise each paragraph is appended after splitting the last
+paragraph at its end.
+*/
+func (ps *Permascroll) AppendParagraphs(text string) error {
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("failed append: %w", errEncoding)
+	}
+
+	ps.Flush()
+	for _, p := range strings.Split(importParagraphs(text), "\n") {
+		if len(p) == 0 {
+			continue
+		}
+
+		pn := len(ps.document)
+		if len(ps.document) > 1 || len(ps.document[0]) > 0 {
+			ps.SplitParagraph(pn, len(ps.document[pn-1]))
+			pn++
+		}
+
+		ps.AppendText(pn, p)
+		ps.Flush()
+	}
+
+	return nil
+}
+
+// Open or create a permascroll file, resuming from a checkpoint if possible.
+// Returns an error wrapping ErrLocked if another process has it open.
+func (ps *Permascroll) OpenPermascroll(path string) (err error) {
+	if err = ps.lockPermascroll(path); err != nil {
+		return fmt.Errorf("failed to open permascroll: %w", err)
+	}
+
+	ps.readOnly = false
+	warning, err := ps.readPermascroll(path)
+	if err == nil {
+		ps.file, err = of.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	}
+
+	if err == nil && len(ps.permascroll) == 0 {
+		ps.permascroll = []byte(magic)
+		if _, err = ps.file.WriteString(magic); err != nil {
+			ps.file.Close() // Ignore error; WriteString error takes precedence
 		}
 	}
 
 	if err != nil {
-		err = fmt.Errorf("failed export: %w", err)
+		ps.unlockPermascroll()
+
+		return fmt.Errorf("failed to open permascroll: %w", err)
 	}
 
-	return err
+	return warning
+}
+
+// Open a permascroll file without locking it or writing to it, for example
+// while another process is editing it.  Operations that would be persisted
+// panic.
+func (ps *Permascroll) OpenReadOnly(path string) (err error) {
+	ps.readOnly = true
+	warning, err := ps.readPermascroll(path)
+	if err != nil {
+		return fmt.Errorf("failed to open permascroll: %w", err)
+	}
+
+	if len(ps.permascroll) == 0 {
+		ps.permascroll = []byte(magic)
+	}
+
+	return warning
+}
+
+/*
+Replay the complete records appended to a read-only permascroll file by another
+process since it was opened or last followed.  Only the part of the file
+following the records already replayed is read.  A record that is still being
+written is left until it is complete.  A damaged record is remembered and
+ignored together with any records that follow it.  If the file has shrunk or its
+damaged records have been replaced, for example because the other process
+removed a damaged tail, it is read again from the beginning.  Returns true if
+the document may have changed.
+*/
+func (ps *Permascroll) FollowPermascroll() (changed bool, err error) {
+	if !ps.readOnly {
+		return false, nil
+	}
+
+	f, err := os.Open(ps.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to follow permascroll: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to follow permascroll: %w", err)
+	}
+
+	size := int(info.Size())
+	if size < len(magic) {
+		return false, nil
+	}
+
+	head, b := make([]byte, len(magic)), make([]byte, max(size-len(ps.permascroll), 0))
+	if _, err = f.ReadAt(head, 0); err == nil && len(b) > 0 {
+		_, err = f.ReadAt(b, int64(len(ps.permascroll)))
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to follow permascroll: %w", err)
+	}
+
+	if size < len(ps.permascroll)+len(ps.tail) || !bytes.Equal(head, ps.permascroll[:len(magic)]) ||
+		!bytes.HasPrefix(b, ps.tail) {
+		ps.Init("")
+		if _, err = ps.readPermascroll(ps.path); err != nil {
+			err = fmt.Errorf("failed to follow permascroll: %w", err)
+		}
+
+		return true, err
+	}
+
+	end := bytes.LastIndexByte(b, '\n') + 1
+	if end <= len(ps.tail) {
+		return false, nil
+	} else if len(ps.tail) > 0 { // The records follow a damaged record
+		ps.tail = b[:end]
+
+		return false, nil
+	}
+
+	source := len(ps.permascroll)
+	ps.permascroll = append(ps.permascroll, b[:end]...)
+	if bad := ps.tryReplay(source); bad >= 0 {
+		ps.tail = bytes.Clone(ps.permascroll[bad:])
+		ps.replayGood(bad)
+
+		return true, fmt.Errorf("failed to follow permascroll: %w, damaged record ignored", ErrRecovered)
+	}
+
+	return true, nil
 }
 
-// Open or create a permascroll file.
-func OpenPermascroll(path string) (err error) {
-	permascroll, err = os.ReadFile(path)
-	if err == nil && len(permascroll) > 0 {
-		parsePermascroll()
+// Path of the permascroll file, or empty if it is not stored in a file.
+func (ps *Permascroll) Path() string { return ps.path }
+
+// True if the permascroll was opened read-only.
+func (ps *Permascroll) ReadOnly() bool { return ps.readOnly }
+
+// Read and replay a permascroll file, if it exists.  Returns a warning wrapping
+// ErrRecovered if a damaged tail was removed.
+func (ps *Permascroll) readPermascroll(path string) (warning, err error) {
+	ps.path, ps.mirrored, ps.tail = path, 0, nil
+	ps.permascroll, err = os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
 	}
 
-	file, err = of.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err == nil && len(permascroll) == 0 {
-		permascroll = []byte(magic)
-		if _, err = file.WriteString(magic); err != nil {
-			file.Close() // Ignore error; WriteString error takes precedence
+	data := ps.permascroll
+
+	if err == nil && len(ps.permascroll) > 0 {
+		switch {
+		case ps.loadCheckpoint(path):
+			warning = ps.recoverReplay(path, ps.checkpoint)
+		case ps.parseMagic():
+			warning = ps.recoverReplay(path, len(magic))
+		default:
+			err = fmt.Errorf("invalid magic, %w", errParse)
+		}
+
+		if warning != nil && !errors.Is(warning, ErrRecovered) {
+			err = warning
 		}
 	}
 
+	if ps.readOnly && len(ps.permascroll) < len(data) { // Remember the complete records of a damaged tail
+		ps.tail = bytes.Clone(data[len(ps.permascroll) : bytes.LastIndexByte(data, '\n')+1])
+	}
+
+	return warning, err
+}
+
+/*
+Replay the permascroll starting from source.  If a record cannot be replayed,
+for example because it was only partially written, that record and everything
+after it are appended to a sidecar file and removed from the permascroll, and
+the preceding operations are replayed again.  A read-only permascroll is left
+unchanged and the damaged tail is ignored.  Returns an error wrapping
+ErrRecovered if this happens.
+*/
+func (ps *Permascroll) recoverReplay(path string, source int) (err error) {
+	bad := ps.tryReplay(source)
+	if bad < 0 {
+		return nil
+	}
+
+	if ps.readOnly {
+		ps.replayGood(bad)
+
+		return fmt.Errorf("%w, damaged tail from offset %d ignored", ErrRecovered, bad)
+	}
+
+	var f *os.File
+	if f, err = os.OpenFile(path+corruptSuffix, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+		return fmt.Errorf("failed recovery: %w", err)
+	}
+
+	if _, err = f.Write(ps.permascroll[bad:]); err == nil {
+		err = f.Close()
+	} else {
+		f.Close() // Ignore error; Write error takes precedence
+	}
+
+	if err == nil {
+		err = os.Truncate(path, int64(bad))
+	}
+
 	if err != nil {
-		err = fmt.Errorf("failed to open permascroll: %w", err)
+		return fmt.Errorf("failed recovery: %w", err)
 	}
 
-	return err
+	ps.replayGood(bad)
+
+	return fmt.Errorf("%w, damaged tail from offset %d moved to %s", ErrRecovered, bad, path+corruptSuffix)
+}
+
+// Replay the permascroll again from the beginning, discarding everything from
+// the offset of the first operation that could not be replayed.
+func (ps *Permascroll) replayGood(bad int) {
+	good := ps.permascroll[:bad]
+	readOnly := ps.readOnly
+	ps.Init("")
+	ps.permascroll, ps.readOnly = good, readOnly
+	ps.parsePermascroll()
+}
+
+// Replay the operations in the permascroll starting from source.  Returns the
+// offset of the first operation that could not be parsed or applied, or -1 if
+// none.
+func (ps *Permascroll) tryReplay(source int) (bad int) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); !ok || !errors.Is(e, errParse) && !errors.Is(e, errRange) {
+				panic(r)
+			}
+
+			bad = source
+		}
+	}()
+
+	for source < len(ps.permascroll) {
+		ps.replayOperation(&source)
+	}
+
+	return -1
 }
 
 // Persist an operation to the permascroll.
-func persist(s string) {
-	delta := newVersion(len(permascroll))
+func (ps *Permascroll) persist(now time.Time, body string) {
+	if ps.readOnly {
+		panic(fmt.Errorf("persist failed: %w", errReadOnly))
+	}
+
+	ts, t := ps.encodeTime(now)
+	delta := ps.newVersion(len(ps.permascroll), ts)
 	if delta < 0 {
 		return
 	}
 
+	ps.lastTime = ts
+	s := t + body
 	if delta > 0 {
 		s = strconv.Itoa(delta) + s
 	}
 
 	s += "\n"
-	permascroll = append(permascroll, []byte(s)...)
-	if _, err := file.WriteString(s); err != nil {
-		file.Close() // ignore error; Write error takes precedence
+	ps.permascroll = append(ps.permascroll, []byte(s)...)
+	if _, err := ps.file.WriteString(s); err != nil {
+		ps.file.Close() // ignore error; Write error takes precedence
 		panic(fmt.Errorf("persist failed: %w", err))
 	}
+
+	if ps.observe != nil {
+		ps.observe(Operation{ps.current, ps.history[ps.current].parent, ts, body, s})
+	}
 }
 
 // Ensure the permascroll backing store is written to stable storage.
-func SyncPermascroll() (err error) {
-	Flush()
-	if err = file.Sync(); err != nil {
-		err = fmt.Errorf("failed to sync permascroll: %w", err)
+// A checkpoint is written if the permascroll has grown sufficiently.
+func (ps *Permascroll) SyncPermascroll() (err error) {
+	ps.Flush()
+	if ps.readOnly {
+		return nil
 	}
 
-	return err
+	if err = ps.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync permascroll: %w", err)
+	}
+
+	return ps.updateCheckpoint()
 }
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -46,10 +50,10 @@ var (
 func init() { of = mockOpener }
 
 func TestClosePermascroll(t *testing.T) {
-	file = &mockFileType{err: errInvalidArg}
+	std.file = &mockFileType{err: errInvalidArg}
 	require.ErrorContains(t, ClosePermascroll(), "failed to close permascroll: invalid argument")
 
-	file = &mockFileType{}
+	std.file = &mockFileType{}
 	require.NoError(t, ClosePermascroll())
 }
 
@@ -58,7 +62,7 @@ func TestExportText(t *testing.T) {
 
 	assert.PanicsWithError("paragraph '2' out of range", func() { _ = ExportText("", 2, 0, 0) })
 
-	document = []string{"One", "Two"}
+	std.document = []string{"One", "Two"}
 	mockOpener.err = errInvalidArg
 	require.ErrorContains(t, ExportText("", 1, 0, 1), "failed export: ")
 	mockOpener.err = nil
@@ -81,6 +85,74 @@ func TestExportText(t *testing.T) {
 	mockFile.err = nil
 }
 
+func TestExportSpan(t *testing.T) {
+	assert := assert.New(t)
+	std.document = []string{"One", "Two", "Three"}
+
+	mockFile = &mockFileType{}
+	require.NoError(t, ExportSpan("", 1, 1, 1, 2))
+	assert.Equal("n\n", mockFile.contents)
+
+	mockFile.contents = ""
+	require.NoError(t, ExportSpan("", 1, 1, 3, 2))
+	assert.Equal("ne\n\nTwo\n\nTh\n", mockFile.contents)
+
+	mockOpener.err = errInvalidArg
+	require.ErrorContains(t, ExportSpan("", 1, 0, 2, 1), "failed export: ")
+	mockOpener.err = nil
+
+	mockFile.err = errInvalidArg
+	require.ErrorContains(t, ExportSpan("", 1, 0, 2, 1), "failed export: ")
+	mockFile.err = nil
+}
+
+func TestImportParagraphs(t *testing.T) {
+	tests := map[string]struct{ text, expect string }{
+		"empty":     {"", ""},
+		"blank":     {"\n \n\n", ""},
+		"single":    {"One\n", "One"},
+		"lines":     {"One\r\ntwo \n three\r\n", "One two three"},
+		"paragraph": {"\nOne\n\n\nTwo\n  \nThree", "One\nTwo\nThree"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) { assert.Equal(t, test.expect, importParagraphs(test.text), name) })
+	}
+}
+
+func TestImportText(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "import.txt")
+	Init("I1,0:AB\n")
+	std.file = &mockFileType{}
+
+	assert.PanicsWithError("paragraph '2' out of range", func() { _ = ImportText(path, 2, 0) })
+	require.ErrorContains(t, ImportText(path, 1, 0), "failed import: ")
+
+	require.NoError(t, os.WriteFile(path, []byte{0xff}, 0o600))
+	require.ErrorContains(t, ImportText(path, 1, 0), "failed import: invalid UTF-8")
+
+	require.NoError(t, os.WriteFile(path, []byte("One\ntwo\n\nThree\n"), 0o600))
+	InsertText(1, 1, "x")
+	require.NoError(t, ImportText(path, 1, 2))
+	assert.Equal([]string{"AxOne two", "ThreeB"}, std.document)
+	p, o := GetPos()
+	assert.Equal([]int{2, 5}, []int{p, o}, "end of the import")
+	assert.Contains(string(std.permascroll), "+0I1,2:One two\\nThree\n")
+
+	Undo()
+	assert.Equal([]string{"AxB"}, std.document, "single operation")
+
+	require.NoError(t, os.WriteFile(path, []byte("Four"), 0o600))
+	require.NoError(t, ImportText(path, 1, 0))
+	assert.Equal([]string{"FourAxB"}, std.document)
+
+	std.legacy = true
+	require.NoError(t, os.WriteFile(path, []byte("One\n\nTwo"), 0o600))
+	require.ErrorContains(t, ImportText(path, 1, 0), "failed import: paragraph break unsupported by JottyV0")
+	std.legacy = false
+}
+
 func TestOpenPermascroll(t *testing.T) {
 	mockOpener.err = errInvalidArg
 	require.ErrorContains(t, OpenPermascroll(""), "failed to open permascroll: ")
@@ -100,26 +172,244 @@ func TestOpenPermascroll(t *testing.T) {
 	if _, err = testFile.WriteString(testData); err != nil {
 		panic(err)
 	}
-	document = []string{""}
+	std.document = []string{""}
 	require.NoError(t, OpenPermascroll(name))
-	assert.Equal(t, []string{"Test"}, document)
+	assert.Equal(t, []string{"Test"}, std.document)
 	assert.Equal(t, testData, mockFile.contents)
 	require.NoError(t, ClosePermascroll())
 }
 
+func TestRecoverPermascroll(t *testing.T) {
+	assert := assert.New(t)
+	mockFile = &mockFileType{}
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	const good, damaged = magic + "I1,0:Test\nS1,2\n", "I2,0:Tru"
+	require.NoError(t, os.WriteFile(path, []byte(good+damaged), 0o600))
+	p := New("")
+	err := p.OpenPermascroll(path)
+	require.ErrorIs(t, err, ErrRecovered)
+	assert.ErrorContains(err, path+corruptSuffix)
+	assert.Equal([]string{"Te", "st"}, p.document)
+	assert.Equal(3, p.Versions())
+	assert.Equal(good, string(p.permascroll))
+
+	contents, _ := os.ReadFile(path)
+	assert.Equal(good, string(contents))
+	contents, _ = os.ReadFile(path + corruptSuffix)
+	assert.Equal(damaged, string(contents))
+	require.NoError(t, p.ClosePermascroll())
+
+	// A final operation that cannot be applied is also treated as damage
+	require.NoError(t, os.WriteFile(path, []byte(good+"D9,0:X\n"), 0o600))
+	p = New("")
+	require.ErrorIs(t, p.OpenPermascroll(path), ErrRecovered)
+	assert.Equal([]string{"Te", "st"}, p.document)
+	contents, _ = os.ReadFile(path + corruptSuffix)
+	assert.Equal(damaged+"D9,0:X\n", string(contents))
+	require.NoError(t, p.ClosePermascroll())
+
+	// A damaged record is moved to the sidecar file with the records following it
+	require.NoError(t, os.WriteFile(path, []byte(good+"D9,0:X\nI1,0:A\n"), 0o600))
+	p = New("")
+	err = p.OpenPermascroll(path)
+	require.ErrorIs(t, err, ErrRecovered)
+	assert.ErrorContains(err, "damaged tail from offset "+strconv.Itoa(len(good)))
+	assert.Equal([]string{"Te", "st"}, p.document)
+	contents, _ = os.ReadFile(path)
+	assert.Equal(good, string(contents))
+	contents, _ = os.ReadFile(path + corruptSuffix)
+	assert.Equal(damaged+"D9,0:X\nD9,0:X\nI1,0:A\n", string(contents))
+	require.NoError(t, p.ClosePermascroll())
+
+	require.NoError(t, os.WriteFile(path, []byte("JottyVX\n"), 0o600))
+	require.ErrorContains(t, New("").OpenPermascroll(path), "failed to open permascroll: invalid magic")
+
+	// The damaged tail is left in place if it cannot be saved
+	require.NoError(t, os.WriteFile(path, []byte(good+damaged), 0o600))
+	require.NoError(t, os.Remove(path+corruptSuffix))
+	require.NoError(t, os.Mkdir(path+corruptSuffix, 0o700))
+	require.ErrorContains(t, New("").OpenPermascroll(path), "failed to open permascroll: failed recovery: ")
+	contents, _ = os.ReadFile(path)
+	assert.Equal(good+damaged, string(contents))
+}
+
+func TestLockPermascroll(t *testing.T) {
+	assert := assert.New(t)
+	mockFile = &mockFileType{}
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	p := New("")
+	require.NoError(t, p.OpenPermascroll(path))
+	holder, _ := os.ReadFile(path + lockSuffix)
+	assert.Equal(strconv.Itoa(os.Getpid())+"\n", string(holder))
+
+	err := New("").OpenPermascroll(path)
+	require.ErrorIs(t, err, ErrLocked)
+	assert.ErrorContains(err, "failed to open permascroll: permascroll locked by process "+strconv.Itoa(os.Getpid()))
+
+	require.NoError(t, p.ClosePermascroll())
+	assert.NoFileExists(path + lockSuffix)
+
+	// A lock file left behind by a crashed process is stale
+	require.NoError(t, os.WriteFile(path+lockSuffix, []byte("1\n"), 0o600))
+	p = New("")
+	require.NoError(t, p.OpenPermascroll(path))
+	require.NoError(t, p.ClosePermascroll())
+
+	require.NoError(t, p.OpenPermascroll(os.DevNull), "only regular files are locked")
+	assert.Nil(p.lock)
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	mockFile = &mockFileType{}
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	const good, damaged = magic + "I1,0:Test\n", "S1,2"
+	require.NoError(t, os.WriteFile(path, []byte(good), 0o600))
+	p := New("")
+	require.NoError(t, p.OpenPermascroll(path), "locked by another writer")
+	require.NoError(t, os.WriteFile(path, []byte(good+damaged), 0o600))
+	q := New("")
+	err := q.OpenReadOnly(path)
+	require.ErrorIs(t, err, ErrRecovered)
+	assert.ErrorContains(err, "damaged tail from offset "+strconv.Itoa(len(good))+" ignored")
+	assert.True(q.ReadOnly())
+	assert.Equal([]string{"Test"}, q.document)
+	assert.Empty(q.tail, "incomplete record")
+	contents, _ := os.ReadFile(path)
+	assert.Equal(good+damaged, string(contents), "unchanged")
+
+	assert.PanicsWithError("persist failed: permascroll is read-only", func() { q.SplitParagraph(1, 2) })
+	require.NoError(t, q.ClosePermascroll())
+
+	// Records following a damaged record are ignored
+	require.NoError(t, os.WriteFile(path, []byte(good+"D9,0:X\nI1,0:A\n"), 0o600))
+	q = New("")
+	err = q.OpenReadOnly(path)
+	require.ErrorIs(t, err, ErrRecovered)
+	assert.ErrorContains(err, "damaged tail from offset "+strconv.Itoa(len(good))+" ignored")
+	assert.Equal([]string{"Test"}, q.document)
+	assert.Equal("D9,0:X\nI1,0:A\n", string(q.tail))
+	contents, _ = os.ReadFile(path)
+	assert.Equal(good+"D9,0:X\nI1,0:A\n", string(contents), "unchanged")
+	require.NoError(t, q.SyncPermascroll())
+	require.NoError(t, q.ClosePermascroll())
+	require.NoError(t, p.ClosePermascroll())
+
+	require.NoError(t, New("").OpenReadOnly(filepath.Join(t.TempDir(), "none.jot")))
+	require.ErrorContains(t, New("").OpenReadOnly(t.TempDir()), "failed to open permascroll: ")
+}
+
+func TestFollowPermascroll(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "test.jot")
+	appendFile := func(s string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.WriteString(s)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	p := New("")
+	changed, err := p.FollowPermascroll()
+	assert.False(changed, "not read-only")
+	require.NoError(t, err)
+
+	require.NoError(t, p.OpenReadOnly(path))
+	changed, err = p.FollowPermascroll()
+	assert.False(changed, "not created yet")
+	require.NoError(t, err)
+
+	appendFile(magic + "I1,0:Test\nS1,")
+	changed, err = p.FollowPermascroll()
+	assert.True(changed)
+	require.NoError(t, err)
+	assert.Equal([]string{"Test"}, p.document)
+
+	appendFile("2\n")
+	changed, err = p.FollowPermascroll()
+	assert.True(changed, "record completed")
+	require.NoError(t, err)
+	assert.Equal([]string{"Te", "st"}, p.document)
+	assert.Equal(3, p.Versions())
+
+	changed, err = p.FollowPermascroll()
+	assert.False(changed, "unchanged")
+	require.NoError(t, err)
+
+	appendFile("D9,0:X\n")
+	changed, err = p.FollowPermascroll()
+	assert.True(changed)
+	require.ErrorIs(t, err, ErrRecovered)
+	assert.Equal([]string{"Te", "st"}, p.document)
+	assert.Equal("D9,0:X\n", string(p.tail))
+
+	appendFile("I1,0:A\n")
+	changed, err = p.FollowPermascroll()
+	assert.False(changed, "record following a damaged record")
+	require.NoError(t, err)
+	assert.Equal("D9,0:X\nI1,0:A\n", string(p.tail))
+
+	require.NoError(t, os.WriteFile(path, []byte(magic+"I1,0:Test\nS1,2\nD1,0:Te\nI1,0:AB\n"), 0o600))
+	changed, err = p.FollowPermascroll()
+	assert.True(changed, "damaged records replaced")
+	require.NoError(t, err)
+	assert.Equal([]string{"AB", "st"}, p.document)
+	assert.Empty(p.tail)
+
+	require.NoError(t, os.WriteFile(path, []byte(magicV0+"I1,0:New\n"), 0o600))
+	changed, err = p.FollowPermascroll()
+	assert.True(changed, "replaced")
+	require.NoError(t, err)
+	assert.Equal([]string{"New"}, p.document)
+	assert.True(p.legacy)
+}
+
 func TestPersist(t *testing.T) {
-	docInsert("Test")
-	file = &mockFileType{err: errInvalidArg}
-	assert.PanicsWithError(t, "persist failed: invalid argument", func() { persist("error") })
+	std.docInsert("Test")
+	std.file = &mockFileType{err: errInvalidArg}
+	assert.PanicsWithError(t, "persist failed: invalid argument", func() { std.persist(time.Time{}, "error") })
 
-	file = &mockFileType{}
-	require.NotPanics(t, func() { persist("OK") })
+	std.file = &mockFileType{}
+	require.NotPanics(t, func() { std.persist(time.Time{}, "OK") })
 }
 
 func TestSyncPermascroll(t *testing.T) {
-	file = &mockFileType{err: errInvalidArg}
+	std.file = &mockFileType{err: errInvalidArg}
 	require.ErrorContains(t, SyncPermascroll(), "failed to sync permascroll: invalid argument")
 
-	file = &mockFileType{}
+	std.file = &mockFileType{}
 	require.NoError(t, SyncPermascroll())
 }
+
+func TestAppendParagraphs(t *testing.T) {
+	assert := assert.New(t)
+	p := New("")
+	p.file = &mockFileType{}
+
+	require.NoError(t, p.AppendParagraphs("One\ntwo.\n\n\nThree.\n"))
+	assert.Equal([]string{"One two.", "Three."}, p.document)
+	require.NoError(t, p.AppendParagraphs("Four."))
+	assert.Equal([]string{"One two.", "Three.", "Four."}, p.document)
+	assert.Equal(magic+"+0I1,0:One two.\n+0S1,8\n+0I2,0:Three.\n+0S2,6\n+0I3,0:Four.\n", string(p.permascroll))
+
+	require.NoError(t, p.AppendParagraphs("\n\n"))
+	assert.Equal(5, p.CurrentVersion())
+	require.ErrorContains(t, p.AppendParagraphs("\xff"), "failed append: ")
+}
+
+func TestWriteText(t *testing.T) {
+	assert := assert.New(t)
+	p := New("I1,0:One\nS1,3\nI2,0:<Two>\n")
+	var b strings.Builder
+	require.NoError(t, p.WriteText(&b))
+	assert.Equal("One\n\n<Two>\n", b.String())
+
+	b.Reset()
+	require.NoError(t, p.SetExportFormat("md"))
+	require.NoError(t, p.WriteText(&b))
+	assert.Equal("One\n\n\\<Two\\>\n", b.String())
+}
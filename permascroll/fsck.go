@@ -0,0 +1,218 @@
+package permascroll
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+/*
+Implements verification of a serialised permascroll without modifying it.
+
+Every operation is parsed and validated against the state of the document that
+it applies to before it is replayed, so that problems are reported rather than
+causing a panic.  A record that cannot be parsed is skipped.  An operation that
+cannot be applied is replaced by a version that leaves the document unchanged,
+so that the undo deltas of later operations still refer to the right versions,
+although later operations that depended on its changes will also be reported.
+
+Hash collisions are detected by comparing the state of every version of the
+document with the same hash, and reported because earlier releases would have
+linked the operation to the wrong version.
+*/
+
+// Results of checking a permascroll.
+type Report struct {
+	Branches   int     // Versions with more than one child
+	Cuts       int     // Entries in the cut buffer
+	Operations int     // Records in the permascroll
+	Problems   []error // Problems found, prefixed by their line numbers
+	Versions   int     // Versions in the history
+}
+
+// Check a serialised permascroll and report on its contents.
+func Check(data []byte) (r Report) {
+	ps := New("")
+	ps.permascroll = data
+	if !ps.parseMagic() {
+		r.Problems = append(r.Problems, fmt.Errorf("line 1: invalid magic, %w", errParse))
+
+		return r
+	}
+	for source := len(magic); source < len(data); r.Operations++ {
+		start := source
+		if err := ps.checkOperation(&source); err != nil {
+			line := bytes.Count(data[:start], []byte{'\n'}) + 1
+			r.Problems = append(r.Problems, fmt.Errorf("line %d: %w", line, err))
+		}
+
+		if source == start { // Skip the record
+			if i := bytes.IndexByte(data[source:], '\n'); i >= 0 {
+				source += i + 1
+			} else {
+				source = len(data)
+			}
+		}
+	}
+
+	children := make([]int, len(ps.history))
+	for _, v := range ps.history[1:] {
+		children[v.parent]++
+	}
+
+	for _, c := range children {
+		if c > 1 {
+			r.Branches++
+		}
+	}
+
+	r.Cuts, r.Versions = len(ps.cut), len(ps.history)
+
+	return r
+}
+
+// Check and replay the operation at source, advancing source past it if it can
+// be parsed.  An operation that cannot be applied is replaced by a version that
+// leaves the document unchanged.
+func (ps *Permascroll) checkOperation(source *int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				panic(r)
+			}
+		}
+	}()
+
+	start, next := *source, *source
+	delta, op := ps.parseOperation(&next)
+	*source = next
+
+	if delta >= len(ps.history) {
+		ps.skipVersion(start, op.ts)
+
+		return fmt.Errorf("undo delta '%d' %w", delta, errRange)
+	}
+
+	ps.GotoVersion(len(ps.history) - 1 - delta)
+	if err = ps.checkValid(op); err != nil {
+		ps.skipVersion(start, op.ts)
+
+		return err
+	}
+
+	ps.docRedo(op)
+	if h := ps.hashDocument(); len(ps.histHash[h]) > 0 && ps.findVersion(h, ps.digestDocument()) < 0 {
+		err = fmt.Errorf("version '%d' %w", ps.histHash[h][0], errCollision)
+	}
+
+	ps.newVersion(start, op.ts)
+	if !op.ts.IsZero() {
+		ps.lastTime = op.ts
+	}
+
+	return err
+}
+
+// The reason that an operation cannot be applied to the document, if any.
+func (ps *Permascroll) checkValid(op operation) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				panic(r)
+			}
+		}
+	}()
+
+	ps.validateOperation(op)
+
+	return nil
+}
+
+// Add a version for the operation at source that leaves the document unchanged,
+// so that the undo deltas of the operations that follow it still refer to the
+// versions they were recorded against.
+func (ps *Permascroll) skipVersion(source int, ts time.Time) {
+	parent := ps.current
+	ps.current = len(ps.history)
+	ps.history = append(ps.history, version{source, parent, 0})
+	ps.histDigest, ps.histTime = append(ps.histDigest, ps.digestDocument()), append(ps.histTime, ts)
+	ps.history[parent].lastChild = ps.current
+	if ps.skipped == nil {
+		ps.skipped = map[int]bool{}
+	}
+
+	ps.skipped[ps.current] = true
+	if !ts.IsZero() {
+		ps.lastTime = ts
+	}
+}
+
+// Panic if fewer than size bytes follow pos in paragraph pn, counting each
+// paragraph break as a single byte.
+func (ps *Permascroll) validateSize(pn, pos, size int) {
+	ps.validatePos(pn, pos)
+	remaining := len(ps.document[pn-1]) - pos
+	for i := pn; remaining < size && i < len(ps.document); i++ {
+		remaining += len(ps.document[i]) + 1
+	}
+
+	if size <= 0 || size > remaining {
+		panic(fmt.Errorf("end '%d,%d-%d' %w", pn, pos, pos+size, errRange))
+	}
+}
+
+// Panic if the span is not entirely within the text of the paragraph.
+func (ps *Permascroll) validateText(pn, pos, end int) {
+	ps.validateSpan(pn, pos, end)
+	if end > len(ps.document[pn-1]) {
+		panic(fmt.Errorf("end '%d,%d-%d' %w", pn, pos, end, errRange))
+	}
+}
+
+// Panic if the operation cannot be applied to the document.
+func (ps *Permascroll) validateOperation(op operation) {
+	switch op.code {
+	case 'C':
+		if op.size1 > 0 {
+			ps.validateSize(op.pn, op.offset1, op.size1)
+		} else {
+			ps.validateSize(op.pn, op.offset1, len(op.text1))
+		}
+	case 'D':
+		ps.validateSize(op.pn, op.offset1, len(op.text1))
+	case 'R':
+		ps.validateText(op.pn, op.offset1, op.offset1+len(op.text1))
+	case 'I', 'S':
+		ps.validatePos(op.pn, op.offset1)
+	case 'T':
+		ps.validatePos(op.pn, op.offset1)
+		ps.validateOrigin(op)
+	case 'L':
+		for _, e := range op.ends {
+			ps.validateText(e.pn, e.begin, e.end)
+		}
+	case 'P':
+		ps.validateMove(op.pn, op.size1, op.offset2)
+	case 'M':
+		ps.validatePn(op.pn)
+		if op.pn == len(ps.document) {
+			panic(fmt.Errorf("paragraph '%d' %w", op.pn+1, errRange))
+		}
+	default: // 'X'
+		if op.size1 == 0 {
+			ps.validatePn(op.pn)
+			if op.pn < 2 {
+				panic(fmt.Errorf("paragraph '%d' %w", op.pn, errRange))
+			}
+		} else {
+			ps.validateText(op.pn, op.offset1, op.offset1+op.size1)
+			ps.validateText(op.pn, op.offset2, op.offset2+op.size2)
+			if op.offset2 < op.offset1+op.size1 {
+				panic(fmt.Errorf("overlap '%d-%d/%d-%d' %w", op.offset1, op.offset1+op.size1, op.offset2,
+					op.offset2+op.size2, errRange))
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package permascroll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := map[string]struct {
+		data     string
+		report   Report
+		problems []string
+	}{
+		"empty":   {magic, Report{Versions: 1}, nil},
+		"magic":   {"JottyVX\n", Report{}, []string{"line 1: invalid magic, parse failed"}},
+		"history": {magic + testHistory, Report{Branches: 1, Cuts: 1, Operations: 3, Versions: 4}, nil},
+		"bad":     {magic + "I1,0:A\nQ\nI1,1:B\n", Report{Operations: 3, Versions: 3}, []string{"line 3: invalid"}},
+		"partial": {magic + "I1,0:A\nI1,1:B", Report{Operations: 2, Versions: 2}, []string{"line 3: invalid"}},
+		"range": {
+			magic + "I1,0:A\nD1,0:AB\nS2,0\n", Report{Operations: 3, Versions: 4},
+			[]string{"line 3: end '1,0-2' out of range", "line 4: paragraph '2' out of range"},
+		},
+		"delta":    {magic + "I1,0:A\n2S1,0\n", Report{Operations: 2, Versions: 3}, []string{"line 3: undo delta '2'"}},
+		"merge":    {magic + "M1,0\n", Report{Operations: 1, Versions: 2}, []string{"line 2: paragraph '2' out of range"}},
+		"exchange": {magic + "X1\n", Report{Operations: 1, Versions: 2}, []string{"line 2: paragraph '1' out of range"}},
+		"overlap": {
+			magic + "I1,0:ABC\nX1,0+2/1+2\n", Report{Operations: 2, Versions: 3},
+			[]string{"line 3: overlap '0-2/1-3' out of range"},
+		},
+		"copy":       {magic + "I1,0:AB\nC1,1+5\n", Report{Operations: 2, Versions: 3}, []string{"line 3: end '1,1-6'"}},
+		"spans":      {magic + "I1,0:A\\nB\nC1,0+3\nD1,0:A\\nB\n", Report{Cuts: 1, Operations: 3, Versions: 4}, nil},
+		"beyond":     {magic + "I1,0:A\\nB\nD1,0:A\\nBC\n", Report{Operations: 2, Versions: 3}, []string{"end '1,0-4'"}},
+		"branch":     {magic + "I1,0:A\nS1,1\n1S1,0\n", Report{Branches: 1, Operations: 3, Versions: 4}, nil},
+		"transclude": {magic + "I1,0:AB\nT1,2:8,1+1\n", Report{Operations: 2, Versions: 3}, nil},
+		"origin": {
+			magic + "I1,0:AB\nS1,1\nT1,0:16,0+1\n", Report{Operations: 3, Versions: 4},
+			[]string{"line 4: primedia '0+1' out of range"},
+		},
+		"move": {
+			magic + "I1,0:A\\nB\nP1+1:3\n", Report{Operations: 2, Versions: 3},
+			[]string{"line 3: destination '3' out of range"},
+		},
+		"link": {
+			magic + "I1,0:AB\nL1,0+1/1,1+2:quote\n", Report{Operations: 2, Versions: 3},
+			[]string{"line 3: end '1,1-3' out of range"},
+		},
+		"skipped": {
+			magic + "I1,0:A\nD1,0:AB\n1I1,1:B\n", Report{Branches: 1, Operations: 3, Versions: 4},
+			[]string{"line 3: end '1,0-2' out of range"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) {
+			r := Check([]byte(test.data))
+			assert.Len(t, r.Problems, len(test.problems), name)
+			for i, p := range test.problems {
+				if i < len(r.Problems) {
+					assert.ErrorContains(t, r.Problems[i], p, name)
+				}
+			}
+			r.Problems = nil
+			assert.Equal(t, test.report, r, name)
+		})
+	}
+}
+
+func TestCheckCollision(t *testing.T) {
+	ps := New("")
+	ps.permascroll = []byte(magic + "I1,0:A\nD1,0:A\n")
+	ps.histDigest[0][0]++ // The digest of version 0 no longer matches its hash
+	source := len(magic)
+	assert.NoError(t, ps.checkOperation(&source))
+	assert.ErrorContains(t, ps.checkOperation(&source), "version '0' hash collision")
+	assert.Equal(t, len(ps.permascroll), source)
+	assert.Equal(t, 2, ps.current, "new version")
+}
@@ -0,0 +1,145 @@
+package permascroll
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+/*
+Implements browsing of the version history.  Every operation persisted to the
+permascroll creates a new version whose parent is the version it was applied
+to, so the history forms a tree rooted at the empty version 0.  Undo moves to
+the parent and redo moves to a child, so any version can be reached by undoing
+back to a common ancestor and then redoing forwards along the branch leading to
+the desired version.
+*/
+
+// Information about a single version of the document.
+type VersionInfo struct {
+	Children  []int     // Versions derived from this one, oldest first
+	Code      byte      // Operation that produced this version, or 0 for version 0
+	Created   time.Time // When the version was created, as for VersionAt, if known
+	Offset    int       // Byte offset of the operation within the paragraph
+	Paragraph int       // Paragraph number of the operation
+	Parent    int       // Version this one was derived from
+	Redo      int       // Child version that Redo will follow, if any
+	Replaced  string    // Text replaced by an 'R' operation
+	Target    int       // Paragraph that a 'P' operation moved paragraphs to
+	Text      string    // Text inserted, deleted or cut, or replacement text
+	Time      time.Time // When the operation was performed, if known
+}
+
+// Versions derived directly from version v, oldest first.
+func (ps *Permascroll) children(v int) (c []int) {
+	for i := v + 1; i < len(ps.history); i++ {
+		if ps.history[i].parent == v {
+			c = append(c, i)
+		}
+	}
+
+	return c
+}
+
+// Make child the current version by reapplying its operation.
+func (ps *Permascroll) redoVersion(child int) byte {
+	ps.history[ps.history[child].parent].lastChild = child
+	ps.current = child
+	if ps.skipped[child] {
+		return 0
+	}
+
+	source := ps.history[child].source
+	_, op := ps.parseOperation(&source)
+	ps.docRedo(op)
+	ps.altered, ps.dropped = nil, nil // Already retained with the version
+
+	return op.code
+}
+
+func (ps *Permascroll) validateVersion(v int) {
+	if v < 0 || v >= len(ps.history) {
+		panic(fmt.Errorf("version '%d' %w", v, errRange))
+	}
+}
+
+// The current version of the document.
+func (ps *Permascroll) CurrentVersion() int { return ps.current }
+
+// Get information about a version of the document.
+func (ps *Permascroll) GetVersion(v int) (info VersionInfo) {
+	ps.validateVersion(v)
+
+	info.Children, info.Redo = ps.children(v), ps.history[v].lastChild
+	if v == 0 {
+		return info
+	}
+
+	source := ps.history[v].source
+	_, op := ps.parseOperation(&source)
+	info.Code, info.Paragraph, info.Offset, info.Parent = op.code, op.pn, op.offset1, ps.history[v].parent
+	info.Text, info.Time, info.Created = op.text1, ps.histTime[v], ps.versionTime(v)
+	switch op.code {
+	case 'P':
+		info.Target = op.offset2
+	case 'R':
+		info.Replaced, info.Text = op.text1, op.text2
+	}
+
+	return info
+}
+
+/*
+Move the document to version v by undoing back to the closest common ancestor
+and then redoing forwards along the branch leading to v.  Subsequent calls to
+Redo will follow the same branch.
+*/
+func (ps *Permascroll) GotoVersion(v int) {
+	ps.validateVersion(v)
+
+	ps.Flush()
+	var path []int // Versions from v back to the common ancestor, exclusive
+	for a := v; ; a = ps.history[a].parent {
+		for ps.current > a {
+			ps.docUndo()
+		}
+
+		if ps.current == a {
+			break
+		}
+
+		path = append(path, a)
+	}
+
+	for _, child := range slices.Backward(path) {
+		ps.redoVersion(child)
+	}
+}
+
+// Number of versions of the document, including the initial empty version 0.
+func (ps *Permascroll) Versions() int { return len(ps.history) }
+
+// The version created most recently at or before time t, or -1 if there is
+// none.
+func (ps *Permascroll) VersionAt(t time.Time) int {
+	for v := len(ps.history) - 1; v >= 0; v-- {
+		ts := ps.versionTime(v)
+		if ts.IsZero() { // No earlier version has a timestamp either
+			return -1
+		} else if !ts.After(t) {
+			return v
+		}
+	}
+
+	return -1
+}
+
+// When version v was created.  A version without a timestamp is taken to have
+// been created at the same time as the version preceding it, if that is known.
+func (ps *Permascroll) versionTime(v int) time.Time {
+	for v > 0 && ps.histTime[v].IsZero() {
+		v--
+	}
+
+	return ps.histTime[v]
+}
@@ -0,0 +1,105 @@
+package permascroll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHistory = "I1,0:Test\nR1,0:T\tB\n1@2C1,0:Te\n"
+
+func TestGetVersion(t *testing.T) {
+	assert := assert.New(t)
+	Init(testHistory)
+
+	assert.Equal(4, Versions())
+	assert.Equal(3, CurrentVersion())
+	assert.PanicsWithError("version '4' out of range", func() { GetVersion(4) })
+
+	assert.Equal(VersionInfo{Children: []int{1}, Redo: 1}, GetVersion(0))
+	assert.Equal(VersionInfo{Children: []int{2, 3}, Code: 'I', Paragraph: 1, Redo: 3, Text: "Test"}, GetVersion(1))
+	assert.Equal(VersionInfo{Code: 'R', Paragraph: 1, Parent: 1, Replaced: "T", Text: "B"}, GetVersion(2))
+	assert.Equal(VersionInfo{Code: 'C', Created: epoch.Add(2 * time.Minute), Paragraph: 1, Parent: 1, Text: "Te",
+		Time: epoch.Add(2 * time.Minute)}, GetVersion(3))
+}
+
+func TestGotoVersion(t *testing.T) {
+	assert := assert.New(t)
+	Init(testHistory)
+	assert.PanicsWithError("version '-1' out of range", func() { GotoVersion(-1) })
+
+	GotoVersion(2)
+	assert.Equal(2, CurrentVersion())
+	assert.Equal([]string{"Best"}, std.document)
+
+	Undo()
+	Redo()
+	assert.Equal(2, CurrentVersion())
+
+	GotoVersion(0)
+	assert.Equal([]string{""}, std.document)
+
+	GotoVersion(3)
+	assert.Equal([]string{"st"}, std.document)
+	assert.Equal(1, Cuts())
+
+	InsertText(1, 2, "ing")
+	GotoVersion(1)
+	assert.Equal(5, Versions())
+	assert.Equal([]string{"Test"}, std.document)
+
+	GotoVersion(4)
+	assert.Equal([]string{"sting"}, std.document)
+}
+
+func TestReplayBranch(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:A\nI1,1:B\n1I1,1:C\n")
+
+	Undo()
+	InsertText(1, 1, "D")
+	Flush()
+	GotoVersion(2)
+	InsertText(1, 2, "E")
+	Flush()
+	assert.Contains(string(std.permascroll), "\n2+0I1,1:D\n2+0I1,2:E\n")
+
+	replayed := New(string(std.permascroll[len(magic):]))
+	assert.Equal([]string{"ABE"}, replayed.document)
+	assert.Equal(std.history, replayed.history)
+	replayed.GotoVersion(4)
+	assert.Equal([]string{"AD"}, replayed.document, "parent skipped back to on another branch")
+}
+
+func TestVersionTime(t *testing.T) {
+	assert := assert.New(t)
+	Init("@1I1,0:A\n+500S1,1\nD1,0:A\n+20I2,0:C\n")
+
+	assert.Equal(epoch.Add(time.Minute), GetVersion(1).Time)
+	assert.Equal(epoch.Add(time.Minute+500*time.Millisecond), GetVersion(2).Time)
+	assert.True(GetVersion(3).Time.IsZero())
+	assert.Equal(GetVersion(2).Time, GetVersion(3).Created, "version without a timestamp")
+	assert.Equal(epoch.Add(time.Minute+520*time.Millisecond), GetVersion(4).Time)
+
+	defer func() { clock = func() time.Time { return epoch } }()
+	clock = func() time.Time { return epoch.Add(3*time.Minute + time.Second) }
+	AppendText(1, "B")
+	Flush()
+	assert.Equal(epoch.Add(3*time.Minute+520*time.Millisecond), GetVersion(5).Time)
+	assert.Contains(string(std.permascroll), "\n@2I1,0:B\n")
+}
+
+func TestVersionAt(t *testing.T) {
+	assert := assert.New(t)
+	Init("@1I1,0:A\n+500S1,1\nD1,0:A\n+20I2,0:C\n")
+
+	assert.Equal(-1, VersionAt(epoch), "before the first timestamp")
+	assert.Equal(1, VersionAt(epoch.Add(time.Minute)))
+	assert.Equal(1, VersionAt(epoch.Add(time.Minute+499*time.Millisecond)))
+	assert.Equal(3, VersionAt(epoch.Add(time.Minute+500*time.Millisecond)), "version without a timestamp")
+	assert.Equal(4, VersionAt(epoch.Add(time.Hour)))
+
+	Init("I1,0:A\n")
+	assert.Equal(-1, VersionAt(epoch.Add(time.Hour)), "no timestamps")
+}
@@ -0,0 +1,244 @@
+package permascroll
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Implements typed links between spans of the document, inspired by the
+multi-ended links of Xanadu.  A link has a type such as "comment", "quote" or
+"see-also" and two or more ends, each of which is a span of text within a
+paragraph.  Links are persisted as permascroll records, so creating a link is
+a version of the document that can be undone like any other operation.
+
+The document keeps track of the position of each end of every link so that
+links survive edits.  Text inserted within an end extends it and deleting text
+within an end shrinks it, possibly to nothing.  The previous positions of the
+ends altered by an operation are retained with its version so that undo can
+restore them exactly.
+*/
+
+// Link arguments.
+var (
+	endRx  = regexp.MustCompile(`/(\d+),(\d+)\+(\d+)`)
+	linkRx = regexp.MustCompile(`^(\d+),(\d+)\+(\d+)((?:/\d+,\d+\+\d+)+):(.+)\n`)
+)
+
+type (
+	link struct {
+		kind string    // Type of the link
+		ends []linkEnd // Spans joined by the link
+	}
+	linkEnd struct{ pn, begin, end int } // Paragraph and byte offsets of a span in the document
+	relink  struct {
+		n    int       // Index of the link
+		ends []linkEnd // Ends of the link before they were altered
+	}
+)
+
+// A span of text at one end of a link.
+type LinkEnd struct {
+	Paragraph  int // Paragraph containing the span
+	Begin, End int // Byte offsets of the span within the paragraph
+}
+
+// A typed link between spans of text.
+type Link struct {
+	Kind string    // Type of the link
+	Ends []LinkEnd // Spans joined by the link, in the order they were given
+}
+
+// Serialise the ends of a link.
+func formatEnds(ends []linkEnd) string {
+	s := make([]string, len(ends))
+	for i, e := range ends {
+		s[i] = fmt.Sprintf("%d,%d+%d", e.pn, e.begin, e.end-e.begin)
+	}
+
+	return strings.Join(s, "/")
+}
+
+// Serialisation of all links for inclusion in the hash of the document.
+func (ps *Permascroll) hashLinks() string {
+	var b strings.Builder
+	for _, l := range ps.links {
+		b.WriteString(formatEnds(l.ends) + ":" + l.kind + "\n")
+	}
+
+	return b.String()
+}
+
+// Parse the arguments of a link operation from the permascroll.
+func (ps *Permascroll) parseLink(source *int) (op operation, match [][]byte) {
+	op.code = 'L'
+	match = linkRx.FindSubmatch(ps.permascroll[*source:])
+	if match == nil {
+		return op, match
+	}
+
+	for _, m := range append([][][]byte{match[:4]}, endRx.FindAllSubmatch(match[4], -1)...) {
+		pn, _ := strconv.Atoi(string(m[1]))
+		begin, _ := strconv.Atoi(string(m[2]))
+		size, _ := strconv.Atoi(string(m[3]))
+		op.ends = append(op.ends, linkEnd{pn, begin, begin + size})
+	}
+	op.text1 = ps.unescape(match[5])
+
+	return op, match
+}
+
+// Create a link of the specified type between two or more spans of text.
+func (ps *Permascroll) CreateLink(kind string, ends ...LinkEnd) {
+	if len(kind) == 0 || strings.Contains(kind, "\n") {
+		panic(fmt.Errorf("link type %q %w", kind, errRange))
+	}
+
+	if len(ends) < 2 {
+		panic(fmt.Errorf("link ends '%d' %w", len(ends), errRange))
+	}
+
+	ps.Flush()
+	op := operation{code: 'L', text1: kind}
+	for _, e := range ends {
+		ps.validateText(e.Paragraph, e.Begin, e.End)
+		op.ends = append(op.ends, linkEnd{e.Paragraph, e.Begin, e.End})
+	}
+
+	if ps.legacy {
+		panic(fmt.Errorf("link %w", errLegacy))
+	}
+
+	ps.paragraph, ps.offset = ends[0].Paragraph, ends[0].Begin
+	ps.docLink(op)
+	ps.persist(clock(), fmt.Sprintf("L%s:%s", formatEnds(op.ends), ps.escape(kind)))
+}
+
+func (ps *Permascroll) docLink(op operation) {
+	ps.links = append(ps.links, link{op.text1, slices.Clone(op.ends)})
+}
+
+// The links with at least one end in a paragraph, in the order they were
+// created.
+func (ps *Permascroll) Links(pn int) (l []Link) {
+	ps.validatePn(pn)
+
+	ps.Flush()
+	for _, lk := range ps.links {
+		if !slices.ContainsFunc(lk.ends, func(e linkEnd) bool { return e.pn == pn }) {
+			continue
+		}
+
+		ends := make([]LinkEnd, len(lk.ends))
+		for i, e := range lk.ends {
+			ends[i] = LinkEnd{e.pn, e.begin, e.end}
+		}
+		l = append(l, Link{lk.kind, ends})
+	}
+
+	return l
+}
+
+// Apply shift to every end of every link, retaining the previous ends of any
+// link whose spans change size.
+func (ps *Permascroll) shiftLinks(shift func(linkEnd) linkEnd) {
+	for n, l := range ps.links {
+		ends, altered := make([]linkEnd, len(l.ends)), false
+		for i, e := range l.ends {
+			ends[i] = shift(e)
+			altered = altered || ends[i].end-ends[i].begin != e.end-e.begin
+		}
+
+		if altered {
+			ps.altered = append(ps.altered, relink{n, l.ends})
+		}
+		ps.links[n].ends = ends
+	}
+}
+
+/*
+Adjust the links for the deletion of the text between the current position and
+end in paragraph epn.  Positions within the deleted text move to its beginning
+and those following it are moved.
+*/
+func (ps *Permascroll) deleteLinks(epn, end int) {
+	pn, pos := ps.paragraph, ps.offset
+	move := func(p, o int) (int, int) {
+		switch {
+		case p < pn || (p == pn && o <= pos):
+			return p, o
+		case p < epn || (p == epn && o <= end):
+			return pn, pos
+		case p == epn:
+			return pn, o - end + pos
+		default:
+			return p - (epn - pn), o
+		}
+	}
+
+	ps.shiftLinks(func(e linkEnd) linkEnd {
+		p, begin := move(e.pn, e.begin)
+		_, end := move(e.pn, e.end)
+
+		return linkEnd{p, begin, end}
+	})
+}
+
+/*
+Adjust the links for the insertion of text at the current position that ends at
+end in paragraph epn.  Ends that the text is inserted within are extended, or
+truncated if it contains a paragraph break, and those following it are moved.
+*/
+func (ps *Permascroll) insertLinks(epn, end int) {
+	pn, pos := ps.paragraph, ps.offset
+	ps.shiftLinks(func(e linkEnd) linkEnd {
+		switch {
+		case e.pn > pn:
+			e.pn += epn - pn
+		case e.pn < pn || (e.end <= pos && e.begin < pos):
+		case e.begin >= pos:
+			e.pn, e.begin, e.end = epn, e.begin-pos+end, e.end-pos+end
+		case epn == pn:
+			e.end += end - pos
+		default:
+			e.end = pos
+		}
+
+		return e
+	})
+}
+
+// Adjust the links for the exchange of two paragraphs or text spans in the
+// current paragraph.  Ends straddling the spans are left in place.
+func (ps *Permascroll) exchangeLinks(first, second span) {
+	pn := ps.paragraph
+	ps.shiftLinks(func(e linkEnd) linkEnd {
+		switch {
+		case first.end == 0 && e.pn == pn-1:
+			e.pn = pn
+		case first.end == 0 && e.pn == pn:
+			e.pn = pn - 1
+		case first.end == 0 || e.pn != pn:
+		case e.begin >= first.begin && e.begin < first.end && e.end <= first.end:
+			e.begin, e.end = e.begin+second.end-first.end, e.end+second.end-first.end
+		case e.begin >= first.end && e.begin < second.begin && e.end <= second.begin:
+			delta := (second.end - second.begin) - (first.end - first.begin)
+			e.begin, e.end = e.begin+delta, e.end+delta
+		case e.begin >= second.begin && e.begin < second.end && e.end <= second.end:
+			e.begin, e.end = e.begin+first.begin-second.begin, e.end+first.begin-second.begin
+		}
+
+		return e
+	})
+}
+
+// Restore the ends of the links altered by the operation of version v.
+func (ps *Permascroll) restoreLinks(v int) {
+	for _, r := range slices.Backward(ps.relinked[v]) {
+		ps.links[r.n].ends = r.ends
+	}
+	ps.altered = nil
+}
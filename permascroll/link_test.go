@@ -0,0 +1,104 @@
+package permascroll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateLink(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One two\nS1,3\n")
+
+	assert.PanicsWithError(`link type "" out of range`, func() { CreateLink("", LinkEnd{1, 0, 1}, LinkEnd{2, 0, 1}) })
+	assert.PanicsWithError("link ends '1' out of range", func() { CreateLink("quote", LinkEnd{1, 0, 1}) })
+	assert.PanicsWithError("end '2,1-9' out of range", func() { CreateLink("quote", LinkEnd{1, 0, 1}, LinkEnd{2, 1, 9}) })
+
+	CreateLink("see\\also", LinkEnd{1, 0, 3}, LinkEnd{2, 1, 4})
+	assert.Contains(string(std.permascroll), "+0L1,0+3/2,1+3:see\\\\also\n")
+	link := Link{"see\\also", []LinkEnd{{1, 0, 3}, {2, 1, 4}}}
+	assert.Equal([]Link{link}, Links(1))
+	assert.Equal([]Link{link}, Links(2))
+	assert.Equal(byte('L'), GetVersion(3).Code)
+	assert.Equal("see\\also", GetVersion(3).Text)
+
+	replayed := New(string(std.permascroll[len(magic):]))
+	assert.Equal(std.links, replayed.links)
+
+	CreateLink("quote", LinkEnd{1, 0, 3}, LinkEnd{2, 1, 4})
+	assert.Len(Links(1), 2)
+	Undo()
+	assert.Equal([]Link{link}, Links(1))
+	Undo()
+	assert.Empty(Links(1))
+	CreateLink("comment", LinkEnd{1, 0, 3}, LinkEnd{2, 1, 4})
+	assert.Equal(6, Versions(), "distinct from the link of another type")
+
+	std.legacy = true
+	assert.PanicsWithError("link unsupported by JottyV0", func() {
+		CreateLink("quote", LinkEnd{1, 0, 1}, LinkEnd{2, 0, 1})
+	})
+	std.legacy = false
+}
+
+func TestParseLink(t *testing.T) {
+	assert := assert.New(t)
+
+	Init("I1,0:AB\nL1,0+1/1,1+1/1,0+2:multi\n")
+	assert.Equal([]Link{{"multi", []LinkEnd{{1, 0, 1}, {1, 1, 2}, {1, 0, 2}}}}, Links(1))
+
+	assert.PanicsWithError("invalid arguments for 'L', parse failed", func() { Init("I1,0:AB\nL1,0+1:single\n") })
+	assert.PanicsWithError("invalid arguments for 'L', parse failed", func() { Init("I1,0:AB\nL1,0+1/1,1+1\n") })
+}
+
+func TestShiftLinks(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One two three\nL1,0+3/1,4+3/1,8+5:see-also\n")
+	ends := func() []LinkEnd { return Links(1)[0].Ends }
+
+	InsertText(1, 5, "w")
+	Flush()
+	assert.Equal([]LinkEnd{{1, 0, 3}, {1, 4, 8}, {1, 9, 14}}, ends(), "extended")
+
+	DeleteText(1, 2, 6)
+	Flush()
+	assert.Equal("Onwo three", GetText(1))
+	assert.Equal([]LinkEnd{{1, 0, 2}, {1, 2, 4}, {1, 5, 10}}, ends(), "shrunk")
+
+	SplitParagraph(1, 3)
+	assert.Equal([]LinkEnd{{1, 0, 2}, {1, 2, 3}, {2, 2, 7}}, Links(2)[0].Ends, "truncated")
+
+	ExchangeParagraphs(2)
+	assert.Equal([]LinkEnd{{2, 0, 2}, {2, 2, 3}, {1, 2, 7}}, ends())
+
+	MergeParagraph(1)
+	assert.Equal("o threeOnw", GetText(1))
+	assert.Equal([]LinkEnd{{1, 7, 9}, {1, 9, 10}, {1, 2, 7}}, ends())
+
+	ExchangeText(1, 0, 2, 7, 9)
+	assert.Equal("Onthreeo w", GetText(1))
+	assert.Equal([]LinkEnd{{1, 0, 2}, {1, 9, 10}, {1, 2, 7}}, ends())
+
+	DeleteText(1, 0, 7)
+	Flush()
+	assert.Equal([]LinkEnd{{1, 0, 0}, {1, 2, 3}, {1, 0, 0}}, ends(), "deleted")
+
+	Undo()
+	assert.Equal([]LinkEnd{{1, 0, 2}, {1, 9, 10}, {1, 2, 7}}, ends(), "restored by undo")
+	for range 6 {
+		Undo()
+	}
+	assert.Equal("One two three", GetText(1))
+	assert.Equal([]LinkEnd{{1, 0, 3}, {1, 4, 7}, {1, 8, 13}}, ends())
+}
+
+func TestMoveLinks(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:A\\nB\\nC\nL1,0+1/3,0+1:x\nT3,1:8,0+1\n")
+
+	MoveParagraphs(3, 1, 1)
+	assert.Equal([]string{"CA", "A", "B"}, std.document)
+	assert.Equal([]LinkEnd{{2, 0, 1}, {1, 0, 1}}, Links(1)[0].Ends)
+	assert.Equal([]Transclusion{{Begin: 1, End: 2, Offset: 0, Version: 1}}, Transclusions(1))
+	assert.Empty(std.relinked, "renumbering paragraphs does not alter links")
+}
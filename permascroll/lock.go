@@ -0,0 +1,85 @@
+package permascroll
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Prevents concurrent writers from corrupting a permascroll.  Each process that
+opens a permascroll for writing takes an exclusive advisory lock on a sidecar
+lock file recording its process ID.  The operating system releases the lock
+when the process exits or crashes, so a lock file left behind by a crashed
+process is stale and is simply locked again by the next process to open the
+permascroll.  Processes that only read the permascroll do not take the lock.
+*/
+
+const lockSuffix = ".lock" // Appended to the permascroll path for the lock file
+
+// Lock the permascroll at path against other writers.  Only regular files are
+// locked.
+func (ps *Permascroll) lockPermascroll(path string) (err error) {
+	if info, serr := os.Stat(path); len(path) == 0 || (serr == nil && !info.Mode().IsRegular()) {
+		return nil
+	}
+
+	var f *os.File
+	for f == nil {
+		if f, err = os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, 0o644); err != nil {
+			return fmt.Errorf("failed to lock permascroll: %w", err)
+		}
+
+		if err = lockFile(f); err != nil {
+			holder, _ := io.ReadAll(f)
+			f.Close() // Ignore error; lock error takes precedence
+			if errors.Is(err, ErrLocked) {
+				return fmt.Errorf("%w by process %s", ErrLocked, strings.TrimSpace(string(holder)))
+			}
+
+			return fmt.Errorf("failed to lock permascroll: %w", err)
+		}
+
+		// Retry if the lock file was removed by its previous holder
+		if !sameFile(f, path+lockSuffix) {
+			f.Close() // Ignore error; the lock is abandoned
+			f = nil
+		}
+	}
+
+	if err = f.Truncate(0); err == nil {
+		_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	}
+
+	if err != nil {
+		f.Close() // Ignore error; write error takes precedence
+
+		return fmt.Errorf("failed to lock permascroll: %w", err)
+	}
+
+	ps.lock = f
+
+	return nil
+}
+
+// True if the open file f is the file at path.
+func sameFile(f *os.File, path string) bool {
+	fi, ferr := f.Stat()
+	pi, perr := os.Stat(path)
+
+	return ferr == nil && perr == nil && os.SameFile(fi, pi)
+}
+
+// Remove the lock file and release the lock, if held.
+func (ps *Permascroll) unlockPermascroll() {
+	if ps.lock == nil {
+		return
+	}
+
+	os.Remove(ps.lock.Name()) // Ignore error; the lock is released regardless
+	ps.lock.Close()           // Ignore error; closing releases the lock
+	ps.lock = nil
+}
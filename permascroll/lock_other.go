@@ -0,0 +1,9 @@
+//go:build !unix
+
+package permascroll
+
+import "os"
+
+// Advisory locks are not supported on this platform, so the lock always
+// succeeds.
+func lockFile(_ *os.File) error { return nil }
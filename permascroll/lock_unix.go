@@ -0,0 +1,19 @@
+//go:build unix
+
+package permascroll
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Take an exclusive advisory lock on an open file without waiting.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+
+	return err // nolint:wrapcheck
+}
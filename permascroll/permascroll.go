@@ -2,8 +2,11 @@ package permascroll
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"slices"
 	"strconv"
@@ -22,29 +25,41 @@ history inspired by Ted Nelson's Xanadu designs.
 The document is UTF-8 encoded text divided into paragraphs. Paragraphs are
 numbered starting from 1.  There is no paragraph 0.
 
-As the textual contents are divided into paragraphs, newlines never appear in
-the primedia and are always and only permascroll record separators.  All
+As the textual contents are divided into paragraphs, the paragraphs themselves
+never contain newlines.  InsertText accepts a newline as a paragraph break, so
+the primedia can contain newlines, but the V1 format persists them as the escape
+"\n" and raw newlines are always and only permascroll record separators.  All
 operations contain sufficient information to ensure they are reversible.
 
 This package coalesces adjacent and overlapping text insertions and deletions.
 
 It also maintains hashes of the document and cut buffer contents and uses them
 to detect when a previous state is revisited, thus avoiding persisting the same
-state to the permascroll again and instead updating the version history.
+state to the permascroll again and instead updating the version history.  A
+revisit is only accepted if a SHA-256 digest of the same state also matches, and
+a cut only if its text matches, so that a hash collision results in a new
+version or cut rather than a link to the wrong one.
 */
 
-const magic = "JottyV0\n"
+const (
+	magic   = "JottyV1\n" // Current permascroll format descriptor
+	magicV0 = "JottyV0\n" // Original format without escapes, which can still be read and appended to
+)
 
-var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+var (
+	clock = time.Now // Source of operation timestamps
+	epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
 
 // Regular expressions for parsing permascroll entries.
 var (
-	ccRx = regexp.MustCompile(`(\d+),(\d+)([+:])(.+)\n`)                // Copy and Cut arguments
-	diRx = regexp.MustCompile(`(\d+),(\d+):(.+)\n`)                     // Delete and Insert arguments
-	exRx = regexp.MustCompile(`(\d+)(?:,(\d+)\+(\d+)/(\d+)\+(\d+))?\n`) // Exchange arguments
-	msRx = regexp.MustCompile(`(\d+),(\d+)\n`)                          // Merge and Split arguments
-	opRx = regexp.MustCompile(`(\d*)([@+]\d+)?([CDIMRSX])`)             // Operation prefix
-	reRx = regexp.MustCompile(`(\d+),(\d+):(.+)\t(.+)\n`)               // Replace arguments
+	ccRx = regexp.MustCompile(`^(\d+),(\d+)([+:])(.+)\n`)                // Copy and Cut arguments
+	diRx = regexp.MustCompile(`^(\d+),(\d+):(.+)\n`)                     // Delete and Insert arguments
+	exRx = regexp.MustCompile(`^(\d+)(?:,(\d+)\+(\d+)/(\d+)\+(\d+))?\n`) // Exchange arguments
+	msRx = regexp.MustCompile(`^(\d+),(\d+)\n`)                          // Merge and Split arguments
+	mvRx = regexp.MustCompile(`^(\d+)\+(\d+):(\d+)\n`)                   // Move arguments
+	opRx = regexp.MustCompile(`^(\d*)([@+]\d+)?([CDILMPRSTX])`)          // Operation prefix
+	reRx = regexp.MustCompile(`^(\d+),(\d+):(.+)\t(.+)\n`)               // Replace arguments
 )
 
 type (
@@ -52,288 +67,512 @@ type (
 		text string
 		ts   time.Time
 	}
+	digest  [sha256.Size]byte // Digest of the state of a version
 	span    struct{ begin, end int }
 	version struct{ source, parent, lastChild int }
 )
 
-var (
-	current     int            // Current version in the history
-	cut         []cutType      // Text cut from the document
-	cutHash     map[uint64]int // Map of hashes to cut numbers
-	deleting    int            // Number of bytes to delete starting from offset
-	docHash     []uint64       // Hash of each paragraph
-	document    []string       // Text of each paragraph
-	histHash    map[uint64]int // Map of hashes to version numbers
-	history     []version      // Document history
-	mutex       sync.Mutex     // Mutex to ensure safety of Flush()
-	offset      int            // Current offset in the paragraph
-	paragraph   int            // Current paragraph number
-	pending     string         // Text not yet written to the permascroll
-	permascroll []byte         // Serialised history of all document versions
-)
+// A Permascroll holds one document and its complete version history.
+// Use New to create one; the zero value is not ready for use.
+type Permascroll struct {
+	altered       []relink               // Links altered by the operation being applied
+	checkpoint    int                    // Size of the permascroll when last checkpointed
+	current       int                    // Current version in the history
+	cut           []cutType              // Text cut from the document
+	cutHash       map[uint64]int         // Map of hashes to the first cut with each hash
+	deleting      int                    // Number of bytes to delete starting from offset
+	discarded     map[int][]transclusion // Transclusions dropped by the operation of each version
+	docHash       []uint64               // Hash of each paragraph
+	document      []string               // Text of each paragraph
+	dropped       []transclusion         // Transclusions dropped by the operation being applied
+	file          FileInterface          // Permascroll backing storage
+	format        string                 // Format for every export, or empty to choose by file extension
+	histDigest    []digest               // Digest of each version, to confirm revisits
+	histHash      map[uint64][]int       // Map of hashes to the versions with each hash
+	histTime      []time.Time            // Timestamp of each version, if known
+	history       []version              // Document history
+	lastTime      time.Time              // Timestamp of the most recent operation, if any
+	legacy        bool                   // The permascroll is in the original format without escapes
+	links         []link                 // Links between spans of the document
+	lock          *os.File               // Lock file held while the permascroll is open for writing
+	mirrored      int                    // Size of the permascroll mirrored from a host, if any
+	mutex         sync.Mutex             // Mutex to ensure safety of Flush()
+	observe       func(Operation)        // Observer of persisted operations, if any
+	offset        int                    // Current offset in the paragraph
+	paragraph     int                    // Current paragraph number
+	path          string                 // Path of the permascroll file, if any
+	pending       string                 // Text not yet written to the permascroll
+	permascroll   []byte                 // Serialised history of all document versions
+	readOnly      bool                   // The permascroll file is not written to
+	relinked      map[int][]relink       // Links altered by the operation of each version
+	skipped       map[int]bool           // Versions whose operation could not be applied when checked
+	tail          []byte                 // Damaged records ignored at the end of a read-only permascroll file
+	transclusions []transclusion         // Transcluded text in the document
+}
 
 var (
-	errParse = errors.New("parse failed")
-	errRange = errors.New("out of range")
+	ErrLocked    = errors.New("permascroll locked")    // Returned when another process has the permascroll open
+	ErrRecovered = errors.New("permascroll recovered") // Returned when a damaged tail has been removed
+
+	errCollision = errors.New("hash collision")
+	errEncoding  = errors.New("invalid UTF-8")
+	errLegacy    = errors.New("unsupported by " + strings.TrimSpace(magicV0))
+	errParse     = errors.New("parse failed")
+	errReadOnly  = errors.New("permascroll is read-only")
+	errRange     = errors.New("out of range")
 )
 
-func init() { Init("") }
+// Round a timestamp to the precision recorded in the permascroll and encode it
+// relative to the previous timestamp.
+func (ps *Permascroll) encodeTime(now time.Time) (ts time.Time, s string) {
+	ts = ps.lastTime
+	if ts.IsZero() {
+		ts = epoch
+	}
 
-func cutTime() string {
-	var elapsed time.Duration
-	n := len(cut) - 1
-	now := cut[n].ts
+	elapsed := max(now.Sub(ts), 0)
+	if elapsed >= time.Minute {
+		m := int(elapsed.Minutes())
 
-	if n == 0 || cut[n-1].ts.IsZero() {
-		elapsed = now.Sub(epoch)
-	} else {
-		elapsed = now.Sub(cut[n-1].ts)
+		return ts.Add(time.Minute * time.Duration(m)), "@" + strconv.Itoa(m)
 	}
 
-	if elapsed >= 60*time.Second {
-		return "@" + strconv.Itoa(int(elapsed.Minutes()))
-	}
+	ms := int(elapsed.Milliseconds())
 
-	return "+" + strconv.Itoa(int(elapsed.Milliseconds()))
+	return ts.Add(time.Millisecond * time.Duration(ms)), "+" + strconv.Itoa(ms)
 }
 
-// Compute the hash of the current version of the document and number of cuts.
-func hashDocument() uint64 {
-	size := len(docHash) * 8                                          // Each uint64 is 8 bytes
-	buf := (*[1 << 32]byte)(unsafe.Pointer(&docHash[0]))[0:size:size] // Get the underlying docHash array
+// Compute the hash of the current version of the document, number of cuts,
+// links and transclusions.
+func (ps *Permascroll) hashDocument() uint64 {
 	hash := xxhash.New()
-	_, _ = hash.Write(buf)
-	_, _ = hash.WriteString(strconv.Itoa(len(cut)))
+	ps.writeState(hash)
 
 	return hash.Sum64()
 }
 
-func updateHash(pn int) {
-	docHash[pn-1] = xxhash.Sum64String(document[pn-1])
+// Compute a digest of the same state as hashDocument, which confirms that a
+// version with the same hash has been revisited.
+func (ps *Permascroll) digestDocument() (d digest) {
+	hash := sha256.New()
+	ps.writeState(hash)
+	hash.Sum(d[:0])
+
+	return d
+}
+
+// Write the state of the current version of the document to a hash.
+func (ps *Permascroll) writeState(w io.Writer) {
+	size := len(ps.docHash) * 8                                          // Each uint64 is 8 bytes
+	buf := (*[1 << 32]byte)(unsafe.Pointer(&ps.docHash[0]))[0:size:size] // Get the underlying docHash array
+	_, _ = w.Write(buf)
+	_, _ = io.WriteString(w, strconv.Itoa(len(ps.cut)))
+	_, _ = io.WriteString(w, ps.hashLinks())
+	_, _ = io.WriteString(w, ps.hashTransclusions())
+}
+
+// The version with hash h and digest d, or -1 if there is none.
+func (ps *Permascroll) findVersion(h uint64, d digest) int {
+	for _, v := range ps.histHash[h] {
+		if ps.histDigest[v] == d {
+			return v
+		}
+	}
+
+	return -1
+}
+
+func (ps *Permascroll) updateHash(pn int) {
+	ps.docHash[pn-1] = xxhash.Sum64String(ps.document[pn-1])
+}
+
+// Create a new permascroll initialised from the serialised operations in p.
+func New(p string) *Permascroll {
+	ps := new(Permascroll)
+	ps.Init(p)
+
+	return ps
 }
 
 // Initialise permascroll.
-func Init(p string) {
-	current, deleting, pending, paragraph, offset = 0, 0, "", 1, 0
-	cut = []cutType{}
-	cutHash = map[uint64]int{}
-	document = []string{""} // Start with a single empty paragraph
-	docHash = []uint64{xxhash.Sum64String("")}
-	history = []version{{}} // Start with a single empty version
-	histHash = map[uint64]int{hashDocument(): 0}
-	permascroll = []byte(magic)
+func (ps *Permascroll) Init(p string) {
+	ps.checkpoint, ps.current, ps.deleting, ps.pending, ps.paragraph, ps.offset = 0, 0, 0, "", 1, 0
+	ps.cut = []cutType{}
+	ps.cutHash = map[uint64]int{}
+	ps.document = []string{""} // Start with a single empty paragraph
+	ps.docHash = []uint64{xxhash.Sum64String("")}
+	ps.history = []version{{}} // Start with a single empty version
+	ps.histHash, ps.histDigest = map[uint64][]int{ps.hashDocument(): {0}}, []digest{ps.digestDocument()}
+	ps.histTime = []time.Time{{}}
+	ps.lastTime, ps.legacy = time.Time{}, false
+	ps.permascroll = []byte(magic)
+	ps.discarded, ps.dropped, ps.transclusions = map[int][]transclusion{}, nil, nil
+	ps.altered, ps.links, ps.relinked, ps.skipped = nil, nil, map[int][]relink{}, nil
 
 	if len(p) > 0 {
-		permascroll = append(permascroll, []byte(p)...)
-		parsePermascroll()
+		ps.permascroll = append(ps.permascroll, []byte(p)...)
+		ps.parsePermascroll()
 	}
 }
 
 // Append text to a paragraph.
-func AppendText(pn int, text string) { InsertText(pn, GetSize(pn), text) }
+func (ps *Permascroll) AppendText(pn int, text string) { ps.InsertText(pn, ps.GetSize(pn), text) }
 
 // Copy text from a paragraph between pos and end.  Returns cut number.
-func CopyText(pn, pos, end int) (n int) {
-	validateSpan(pn, pos, end)
+func (ps *Permascroll) CopyText(pn, pos, end int) (n int) {
+	ps.validateSpan(pn, pos, end)
+
+	ps.Flush()
+	ts, _ := ps.encodeTime(clock())
+	n = ps.docCopy(ps.document[pn-1][pos:end], ts)
+	if n == 0 {
+		ps.persist(ts, fmt.Sprintf("C%d,%d+%d", pn, pos, end-pos))
+		n = len(ps.cut)
+	}
+
+	return n
+}
+
+// Copy text between pos in paragraph pn and end in paragraph epn, including the
+// paragraph breaks between them.  Returns cut number.
+func (ps *Permascroll) CopySpan(pn, pos, epn, end int) (n int) {
+	if epn == pn {
+		return ps.CopyText(pn, pos, end)
+	}
+
+	ps.validateRange(pn, pos, epn, end)
 
-	Flush()
-	n = docCopy(document[pn-1][pos:end], time.Now())
+	ps.Flush()
+	text := ps.docSpan(pn, pos, epn, end)
+	ts, _ := ps.encodeTime(clock())
+	n = ps.docCopy(text, ts)
 	if n == 0 {
-		persist(fmt.Sprintf("%sC%d,%d+%d", cutTime(), pn, pos, end-pos))
-		n = len(cut)
+		ps.persist(ts, fmt.Sprintf("C%d,%d+%d", pn, pos, len(text)))
+		n = len(ps.cut)
 	}
 
 	return n
 }
 
 // Number of cuts in the document.
-func Cuts() int { return len(cut) }
+func (ps *Permascroll) Cuts() int { return len(ps.cut) }
 
 // Cut text from a paragraph between pos and end.  Returns cut number.
-func CutText(pn, pos, end int) (n int) {
-	validateSpan(pn, pos, end)
+func (ps *Permascroll) CutText(pn, pos, end int) (n int) {
+	ps.validateSpan(pn, pos, end)
 
-	Flush()
-	text := document[pn-1][pos:end]
-	n = docCopy(document[pn-1][pos:end], time.Now())
+	ps.Flush()
+	text := ps.document[pn-1][pos:end]
+	ts, _ := ps.encodeTime(clock())
+	n = ps.docCopy(ps.document[pn-1][pos:end], ts)
 	if n == 0 {
-		paragraph, offset = pn, pos
-		docDelete(end - pos)
-		persist(fmt.Sprintf("%sC%d,%d:%s", cutTime(), pn, pos, text))
-		n = len(cut)
+		ps.paragraph, ps.offset = pn, pos
+		ps.docDelete(end - pos)
+		ps.persist(ts, fmt.Sprintf("C%d,%d:%s", pn, pos, ps.escape(text)))
+		n = len(ps.cut)
+	}
+
+	return n
+}
+
+// Cut text between pos in paragraph pn and end in paragraph epn, including the
+// paragraph breaks between them.  Returns cut number.
+func (ps *Permascroll) CutSpan(pn, pos, epn, end int) (n int) {
+	if epn == pn {
+		return ps.CutText(pn, pos, end)
+	}
+
+	ps.validateRange(pn, pos, epn, end)
+
+	ps.Flush()
+	text := ps.docSpan(pn, pos, epn, end)
+	ts, _ := ps.encodeTime(clock())
+	n = ps.docCopy(text, ts)
+	if n == 0 {
+		ps.paragraph, ps.offset = pn, pos
+		ps.docDelete(len(text))
+		ps.persist(ts, fmt.Sprintf("C%d,%d:%s", pn, pos, ps.escape(text)))
+		n = len(ps.cut)
 	}
 
 	return n
 }
 
 // Delete text from a paragraph between pos and end.
-func DeleteText(pn, pos, end int) {
-	validateSpan(pn, pos, end)
+func (ps *Permascroll) DeleteText(pn, pos, end int) {
+	ps.validateSpan(pn, pos, end)
 
-	dEnd := offset + deleting
-	pEnd := offset + len(pending)
+	dEnd := ps.offset + ps.deleting
+	pEnd := ps.offset + len(ps.pending)
 	switch {
-	case paragraph != pn || end < offset || pos > max(dEnd, pEnd) || (pos < offset && len(pending) > 0):
-		Flush()
-		deleting, paragraph, offset = end-pos, pn, pos
-	case len(pending) == 0:
-		if pos < offset {
-			offset = pos
+	case ps.paragraph != pn || end < ps.offset || pos > max(dEnd, pEnd) || (pos < ps.offset && len(ps.pending) > 0):
+		ps.Flush()
+		ps.deleting, ps.paragraph, ps.offset = end-pos, pn, pos
+	case len(ps.pending) == 0:
+		if pos < ps.offset {
+			ps.offset = pos
 		}
-		deleting += end - pos
+		ps.deleting += end - pos
 	default:
 		var s string
 		if end < pEnd {
-			s = pending[end-offset:]
+			s = ps.pending[end-ps.offset:]
 		}
-		pending = pending[:pos-offset] + s
+		ps.pending = ps.pending[:pos-ps.offset] + s
 		if end > pEnd {
-			Flush()
-			offset, deleting = pos, end-pEnd
+			ps.Flush()
+			ps.offset, ps.deleting = pos, end-pEnd
 		}
 	}
 }
 
-func docCopy(text string, ts time.Time) int {
+func (ps *Permascroll) docCopy(text string, ts time.Time) int {
 	h := xxhash.Sum64String(text)
-	if v, found := cutHash[h]; found {
-		return v + 1
+	n, found := ps.cutHash[h]
+	if found && ps.cut[n].text != text { // The hash collided with that of another cut
+		n = slices.IndexFunc(ps.cut, func(c cutType) bool { return c.text == text })
+	}
+
+	if found && n >= 0 {
+		return n + 1
 	}
 
-	cut = append(cut, cutType{text, ts})
-	cutHash[h] = len(cut) - 1
+	ps.cut = append(ps.cut, cutType{text, ts})
+	if !found { // Otherwise the hash collided with that of another cut
+		ps.cutHash[h] = len(ps.cut) - 1
+	}
 
 	return 0
 }
 
-func docDelete(size int) {
-	p := document[paragraph-1]
-	document[paragraph-1] = p[:offset] + p[offset+size:]
-	updateHash(paragraph)
+func (ps *Permascroll) docDelete(size int) {
+	epn, end := ps.spanEnd(size)
+	ps.deleteTransclusions(epn, end)
+	ps.deleteLinks(epn, end)
+	ps.document[ps.paragraph-1] = ps.document[ps.paragraph-1][:ps.offset] + ps.document[epn-1][end:]
+	ps.document = slices.Delete(ps.document, ps.paragraph, epn)
+	ps.docHash = slices.Delete(ps.docHash, ps.paragraph, epn)
+	ps.updateHash(ps.paragraph)
 }
 
-func docExchange(first, second span) {
+func (ps *Permascroll) docExchange(first, second span) {
+	ps.shiftExchange(first, second)
+	ps.exchangeLinks(first, second)
 	if first.end == 0 { // Exchange paragraphs
-		document[paragraph-1], document[paragraph-2] = document[paragraph-2], document[paragraph-1]
-		updateHash(paragraph - 1)
+		ps.document[ps.paragraph-1], ps.document[ps.paragraph-2] = ps.document[ps.paragraph-2], ps.document[ps.paragraph-1]
+		ps.updateHash(ps.paragraph - 1)
 	} else { // Exchange text ranges
-		p := document[paragraph-1]
+		p := ps.document[ps.paragraph-1]
 		var t strings.Builder
 		t.WriteString(p[:first.begin])
 		t.WriteString(p[second.begin:second.end])
 		t.WriteString(p[first.end:second.begin])
 		t.WriteString(p[first.begin:first.end])
 		t.WriteString(p[second.end:])
-		document[paragraph-1] = t.String()
+		ps.document[ps.paragraph-1] = t.String()
+	}
+	ps.updateHash(ps.paragraph)
+	ps.offset = first.begin
+}
+
+func (ps *Permascroll) docInsert(text string) {
+	p := ps.document[ps.paragraph-1]
+	if !strings.Contains(text, "\n") {
+		ps.insertTransclusions(ps.paragraph, ps.offset+len(text))
+		ps.insertLinks(ps.paragraph, ps.offset+len(text))
+		ps.document[ps.paragraph-1] = p[:ps.offset] + text + p[ps.offset:]
+		ps.updateHash(ps.paragraph)
+		ps.offset += len(text)
+
+		return
 	}
-	updateHash(paragraph)
-	offset = first.begin
+
+	// Each newline in the text is a paragraph break
+	paras := strings.Split(text, "\n")
+	last := len(paras) - 1
+	offset := len(paras[last])
+	ps.insertTransclusions(ps.paragraph+last, offset)
+	ps.insertLinks(ps.paragraph+last, offset)
+	paras[0], paras[last] = p[:ps.offset]+paras[0], paras[last]+p[ps.offset:]
+	ps.document = slices.Replace(ps.document, ps.paragraph-1, ps.paragraph, paras...)
+	ps.docHash = slices.Replace(ps.docHash, ps.paragraph-1, ps.paragraph, make([]uint64, len(paras))...)
+	for pn := range paras {
+		ps.updateHash(ps.paragraph + pn)
+	}
+	ps.paragraph, ps.offset = ps.paragraph+last, offset
+}
+
+// Text between pos in paragraph pn and end in paragraph epn, with paragraph
+// breaks represented by newlines.
+func (ps *Permascroll) docSpan(pn, pos, epn, end int) string {
+	if epn == pn {
+		return ps.document[pn-1][pos:end]
+	}
+
+	paras := slices.Concat([]string{ps.document[pn-1][pos:]}, ps.document[pn:epn-1], []string{ps.document[epn-1][:end]})
+
+	return strings.Join(paras, "\n")
 }
 
-func docInsert(text string) {
-	p := document[paragraph-1]
-	document[paragraph-1] = p[:offset] + text + p[offset:]
-	updateHash(paragraph)
-	offset += len(text)
+func (ps *Permascroll) docReplace(size int, text string) {
+	p := ps.document[ps.paragraph-1]
+	ps.deleteTransclusions(ps.paragraph, ps.offset+size)
+	ps.deleteLinks(ps.paragraph, ps.offset+size)
+	ps.insertTransclusions(ps.paragraph, ps.offset+len(text))
+	ps.insertLinks(ps.paragraph, ps.offset+len(text))
+	ps.document[ps.paragraph-1] = p[:ps.offset] + text + p[ps.offset+size:]
+	ps.updateHash(ps.paragraph)
+	ps.offset += len(text)
 }
 
-func docReplace(size int, text string) {
-	p := document[paragraph-1]
-	document[paragraph-1] = p[:offset] + text + p[offset+size:]
-	updateHash(paragraph)
-	offset += len(text)
+func (ps *Permascroll) docMerge() {
+	ps.offset = len(ps.document[ps.paragraph-1])
+	ps.deleteTransclusions(ps.paragraph+1, 0)
+	ps.deleteLinks(ps.paragraph+1, 0)
+	ps.document[ps.paragraph-1] += ps.document[ps.paragraph]
+	ps.updateHash(ps.paragraph)
+	ps.document = slices.Delete(ps.document, ps.paragraph, ps.paragraph+1)
+	ps.docHash = slices.Delete(ps.docHash, ps.paragraph, ps.paragraph+1)
 }
 
-func docMerge() {
-	offset = len(document[paragraph-1])
-	document[paragraph-1] += document[paragraph]
-	updateHash(paragraph)
-	document = slices.Delete(document, paragraph, paragraph+1)
-	docHash = slices.Delete(docHash, paragraph, paragraph+1)
+// Move count paragraphs starting from pn so that the first of them becomes
+// paragraph dest.
+func (ps *Permascroll) docMove(pn, count, dest int) {
+	renumber := func(p int) int {
+		if p >= pn && p < pn+count {
+			return p - pn + dest
+		}
+
+		if p >= pn+count {
+			p -= count
+		}
+
+		if p >= dest {
+			p += count
+		}
+
+		return p
+	}
+
+	for i := range ps.transclusions {
+		ps.transclusions[i].pn = renumber(ps.transclusions[i].pn)
+	}
+	ps.shiftLinks(func(e linkEnd) linkEnd {
+		e.pn = renumber(e.pn)
+
+		return e
+	})
+
+	paras := slices.Clone(ps.document[pn-1 : pn-1+count])
+	hashes := slices.Clone(ps.docHash[pn-1 : pn-1+count])
+	ps.document = slices.Insert(slices.Delete(ps.document, pn-1, pn-1+count), dest-1, paras...)
+	ps.docHash = slices.Insert(slices.Delete(ps.docHash, pn-1, pn-1+count), dest-1, hashes...)
+	ps.paragraph, ps.offset = dest, 0
 }
 
-func docSplit() {
-	p := document[paragraph-1]
-	document = slices.Insert(document, paragraph, p[offset:])
-	docHash = slices.Insert(docHash, paragraph, 0)
-	updateHash(paragraph + 1)
-	document[paragraph-1] = p[:offset]
-	updateHash(paragraph)
-	paragraph++
-	offset = 0
+func (ps *Permascroll) docSplit() {
+	p := ps.document[ps.paragraph-1]
+	ps.insertTransclusions(ps.paragraph+1, 0)
+	ps.insertLinks(ps.paragraph+1, 0)
+	ps.document = slices.Insert(ps.document, ps.paragraph, p[ps.offset:])
+	ps.docHash = slices.Insert(ps.docHash, ps.paragraph, 0)
+	ps.updateHash(ps.paragraph + 1)
+	ps.document[ps.paragraph-1] = p[:ps.offset]
+	ps.updateHash(ps.paragraph)
+	ps.paragraph++
+	ps.offset = 0
 }
 
-func docRedo(op operation) {
-	paragraph, offset = op.pn, op.offset1
+func (ps *Permascroll) docRedo(op operation) {
+	ps.paragraph, ps.offset = op.pn, op.offset1
 	switch op.code {
 	case 'C':
 		if op.size1 > 0 {
-			docCopy(document[paragraph-1][offset:offset+op.size1], op.ts)
+			epn, end := ps.spanEnd(op.size1)
+			ps.docCopy(ps.docSpan(ps.paragraph, ps.offset, epn, end), op.ts)
 		} else {
-			docCopy(document[paragraph-1][offset:offset+len(op.text1)], op.ts)
-			docDelete(len(op.text1))
+			ps.docCopy(op.text1, op.ts)
+			ps.docDelete(len(op.text1))
 		}
 	case 'D':
-		docDelete(len(op.text1))
+		ps.docDelete(len(op.text1))
 	case 'I':
-		docInsert(op.text1)
+		ps.docInsert(op.text1)
+	case 'L':
+		ps.docLink(op)
 	case 'M':
-		docMerge()
+		ps.docMerge()
+	case 'P':
+		ps.docMove(op.pn, op.size1, op.offset2)
 	case 'R':
-		docReplace(len(op.text1), op.text2)
+		ps.docReplace(len(op.text1), op.text2)
 	case 'S':
-		docSplit()
+		ps.docSplit()
+	case 'T':
+		ps.docTransclude(op)
 	default: // 'X'
-		docExchange(span{op.offset1, op.offset1 + op.size1}, span{op.offset2, op.offset2 + op.size2})
+		ps.docExchange(span{op.offset1, op.offset1 + op.size1}, span{op.offset2, op.offset2 + op.size2})
 	}
 }
 
-func docUndo() byte {
-	source := history[current].source
-	current = history[current].parent
-	_, op := parseOperation(&source)
-	paragraph, offset = op.pn, op.offset1
+func (ps *Permascroll) docUndo() byte {
+	v := ps.current
+	source := ps.history[v].source
+	ps.current = ps.history[v].parent
+	if ps.skipped[v] {
+		return 0
+	}
+
+	_, op := ps.parseOperation(&source)
+	ps.paragraph, ps.offset = op.pn, op.offset1
 	switch op.code {
 	case 'C':
 		if len(op.text1) > 0 {
-			docInsert(op.text1)
+			ps.docInsert(op.text1)
 		}
 	case 'D':
-		docInsert(op.text1)
-	case 'I':
-		docDelete(len(op.text1))
+		ps.docInsert(op.text1)
+	case 'I', 'T':
+		ps.docDelete(len(op.text1))
+	case 'L':
+		ps.links = ps.links[:len(ps.links)-1]
 	case 'M':
-		docSplit()
+		ps.docSplit()
+	case 'P':
+		ps.docMove(op.offset2, op.size1, op.pn)
 	case 'R':
-		docReplace(len(op.text2), op.text1)
-		offset = op.offset1
+		ps.docReplace(len(op.text2), op.text1)
+		ps.offset = op.offset1
 	case 'S':
-		docMerge()
+		ps.docMerge()
 	default: // 'X'
 		begin := op.offset2 + op.size2 - op.size1
-		docExchange(span{op.offset1, op.offset1 + op.size2}, span{begin, begin + op.size1})
+		ps.docExchange(span{op.offset1, op.offset1 + op.size2}, span{begin, begin + op.size1})
 	}
 
+	ps.transclusions, ps.dropped = append(ps.transclusions, ps.discarded[v]...), nil
+	ps.restoreLinks(v)
+
 	return op.code
 }
 
 // Exchange two paragraphs.
-func ExchangeParagraphs(pn int) {
-	validatePn(pn)
+func (ps *Permascroll) ExchangeParagraphs(pn int) {
+	ps.validatePn(pn)
 	if pn < 2 {
 		panic(fmt.Errorf("paragraph '%d' %w", pn, errRange))
 	}
 
-	Flush()
-	paragraph = pn
-	docExchange(span{}, span{})
-	persist(fmt.Sprintf("X%d", pn))
+	ps.Flush()
+	ps.paragraph = pn
+	ps.docExchange(span{}, span{})
+	ps.persist(clock(), fmt.Sprintf("X%d", pn))
 }
 
 // Exchange two text spans.
-func ExchangeText(pn, b1, e1, b2, e2 int) {
-	validateSpan(pn, b1, e1)
-	validateSpan(pn, b2, e2)
+func (ps *Permascroll) ExchangeText(pn, b1, e1, b2, e2 int) {
+	ps.validateSpan(pn, b1, e1)
+	ps.validateSpan(pn, b2, e2)
 	if b2 < b1 {
 		b1, e1, b2, e2 = b2, e2, b1, e1
 	}
@@ -342,110 +581,142 @@ func ExchangeText(pn, b1, e1, b2, e2 int) {
 		panic(fmt.Errorf("overlap '%d-%d/%d-%d' %w", b1, e1, b2, e2, errRange))
 	}
 
-	Flush()
-	paragraph = pn
-	docExchange(span{b1, e1}, span{b2, e2})
-	persist(fmt.Sprintf("X%d,%d+%d/%d+%d", pn, b1, e1-b1, b2, e2-b2))
+	ps.Flush()
+	ps.paragraph = pn
+	ps.docExchange(span{b1, e1}, span{b2, e2})
+	ps.persist(clock(), fmt.Sprintf("X%d,%d+%d/%d+%d", pn, b1, e1-b1, b2, e2-b2))
 }
 
 // Write pending insertion or deletion to permascroll.
 // Safe to use concurrently.
-func Flush() {
-	mutex.Lock()
-	defer mutex.Unlock()
-	if deleting > 0 {
-		p := document[paragraph-1]
-		t := p[offset : offset+deleting]
-		docDelete(deleting)
-		persist(fmt.Sprintf("D%d,%d:%s", paragraph, offset, t))
-		deleting = 0
-	} else if len(pending) > 0 {
-		o := offset
-		docInsert(pending)
-		persist(fmt.Sprintf("I%d,%d:%s", paragraph, o, pending))
-		pending = ""
+func (ps *Permascroll) Flush() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.deleting > 0 {
+		p := ps.document[ps.paragraph-1]
+		t := p[ps.offset : ps.offset+ps.deleting]
+		ps.docDelete(ps.deleting)
+		ps.persist(clock(), fmt.Sprintf("D%d,%d:%s", ps.paragraph, ps.offset, ps.escape(t)))
+		ps.deleting = 0
+	} else if len(ps.pending) > 0 {
+		o := ps.offset
+		ps.docInsert(ps.pending)
+		ps.persist(clock(), fmt.Sprintf("I%d,%d:%s", ps.paragraph, o, ps.escape(ps.pending)))
+		ps.pending = ""
 	}
 }
 
 // Get a cut from the document.
-func GetCut(n int) (string, time.Time) { return cut[n-1].text, cut[n-1].ts }
+func (ps *Permascroll) GetCut(n int) (string, time.Time) { return ps.cut[n-1].text, ps.cut[n-1].ts }
 
 // Get the current position in the document.
-func GetPos() (p int, o int) { return paragraph, offset }
+func (ps *Permascroll) GetPos() (p int, o int) { return ps.paragraph, ps.offset }
 
 // Get the size of a paragraph.
-func GetSize(pn int) (size int) {
-	validatePn(pn)
+func (ps *Permascroll) GetSize(pn int) (size int) {
+	ps.validatePn(pn)
 
-	size = len(document[pn-1])
+	size = len(ps.document[pn-1])
 
-	if pn == paragraph {
-		size += len(pending) - deleting
+	if pn == ps.paragraph {
+		size += len(ps.pending) - ps.deleting
 	}
 
 	return size
 }
 
 // Get the text of a paragraph.
-func GetText(pn int) (t string) {
-	validatePn(pn)
+func (ps *Permascroll) GetText(pn int) (t string) {
+	ps.validatePn(pn)
 
-	t = document[pn-1]
+	t = ps.document[pn-1]
 
-	if pn == paragraph {
-		if deleting > 0 {
-			t = t[:offset] + t[offset+deleting:]
-		} else if len(pending) > 0 {
-			t = t[:offset] + pending + t[offset:]
+	if pn == ps.paragraph {
+		if ps.deleting > 0 {
+			t = t[:ps.offset] + t[ps.offset+ps.deleting:]
+		} else if len(ps.pending) > 0 {
+			t = t[:ps.offset] + ps.pending + t[ps.offset:]
 		}
 	}
 
 	return t
 }
 
-// Insert text into a paragraph at pos.
-func InsertText(pn int, pos int, text string) {
-	validatePos(pn, pos)
+// Insert text into a paragraph at pos.  Any newlines in the text are inserted as
+// paragraph breaks and the position afterwards is the end of the inserted text.
+func (ps *Permascroll) InsertText(pn int, pos int, text string) {
+	ps.validatePos(pn, pos)
+
+	if strings.Contains(text, "\n") {
+		if ps.legacy {
+			panic(fmt.Errorf("paragraph break %w", errLegacy))
+		}
 
-	if pn == paragraph && deleting == 0 && pos >= offset && pos <= offset+len(pending) {
-		pending = pending[:pos-offset] + text + pending[pos-offset:]
+		ps.Flush()
+		ps.paragraph, ps.offset = pn, pos
+		ps.docInsert(text)
+		ps.persist(clock(), fmt.Sprintf("I%d,%d:%s", pn, pos, ps.escape(text)))
+	} else if pn == ps.paragraph && ps.deleting == 0 && pos >= ps.offset && pos <= ps.offset+len(ps.pending) {
+		ps.pending = ps.pending[:pos-ps.offset] + text + ps.pending[pos-ps.offset:]
 	} else {
-		Flush()
-		pending, paragraph, offset = text, pn, pos
+		ps.Flush()
+		ps.pending, ps.paragraph, ps.offset = text, pn, pos
 	}
 }
 
 // Merge two paragraphs.
-func MergeParagraph(pn int) {
-	validatePn(pn)
+func (ps *Permascroll) MergeParagraph(pn int) {
+	ps.validatePn(pn)
+
+	if pn < len(ps.document) {
+		ps.Flush()
+		ps.paragraph = pn
+		ps.docMerge()
+		ps.persist(clock(), fmt.Sprintf("M%d,%d", pn, ps.offset))
+	}
+}
 
-	if pn < len(document) {
-		Flush()
-		paragraph = pn
-		docMerge()
-		persist(fmt.Sprintf("M%d,%d", pn, offset))
+// Move count paragraphs starting from pn so that the first of them becomes
+// paragraph dest.
+func (ps *Permascroll) MoveParagraphs(pn, count, dest int) {
+	ps.validateMove(pn, count, dest)
+	if ps.legacy {
+		panic(fmt.Errorf("move %w", errLegacy))
 	}
+
+	ps.Flush()
+	ps.docMove(pn, count, dest)
+	ps.persist(clock(), fmt.Sprintf("P%d+%d:%d", pn, count, dest))
 }
 
 // Add a new version to the history.
-func newVersion(source int) int {
-	parent := current
-	h := hashDocument()
-	if v, found := histHash[h]; found {
-		current = v
+func (ps *Permascroll) newVersion(source int, ts time.Time) int {
+	parent := ps.current
+	h, d := ps.hashDocument(), ps.digestDocument()
+	if v := ps.findVersion(h, d); v >= 0 {
+		ps.current, ps.altered, ps.dropped = v, nil, nil
 
 		return -1
 	}
 
-	current = len(history)
-	history = append(history, version{source, parent, 0})
-	history[parent].lastChild, histHash[h] = current, current
+	ps.current = len(ps.history)
+	if len(ps.dropped) > 0 {
+		ps.discarded[ps.current], ps.dropped = ps.dropped, nil
+	}
+
+	if len(ps.altered) > 0 {
+		ps.relinked[ps.current], ps.altered = ps.altered, nil
+	}
+
+	ps.history = append(ps.history, version{source, parent, 0})
+	ps.histDigest, ps.histTime = append(ps.histDigest, d), append(ps.histTime, ts)
+	ps.history[parent].lastChild, ps.histHash[h] = ps.current, append(ps.histHash[h], ps.current)
 
-	return (current - parent) - 1
+	return (ps.current - parent) - 1
 }
 
 // Number of paragraphs in the document.
-func Paragraphs() int { return len(document) }
+func (ps *Permascroll) Paragraphs() int { return len(ps.document) }
 
 /*
 NOTE that this package violates the Go convention that panics should not cross
@@ -455,16 +726,87 @@ were returned instead, every caller would still have to panic after checking for
 them.
 */
 
+// Escape backslashes and control characters in text to be persisted.
+func (ps *Permascroll) escape(text string) string {
+	if ps.legacy || !strings.ContainsFunc(text, func(r rune) bool { return r == '\\' || r < ' ' || r == 0x7f }) {
+		return text
+	}
+
+	var b strings.Builder
+	for i := range len(text) {
+		switch c := text[i]; c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			if c < ' ' || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// Reverse the escaping of text read from the permascroll.
+func (ps *Permascroll) unescape(text []byte) string {
+	if ps.legacy || bytes.IndexByte(text, '\\') < 0 {
+		return string(text)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' {
+			b.WriteByte(text[i])
+
+			continue
+		}
+
+		if i++; i == len(text) {
+			panic(fmt.Errorf("invalid escape at end, %w", errParse))
+		}
+
+		switch text[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'x':
+			if i+3 > len(text) {
+				panic(fmt.Errorf("invalid escape %q, %w", text[i-1:], errParse))
+			}
+
+			c, err := strconv.ParseUint(string(text[i+1:i+3]), 16, 8)
+			if err != nil {
+				panic(fmt.Errorf("invalid escape %q, %w", text[i-1:i+3], errParse))
+			}
+			b.WriteByte(byte(c))
+			i += 2
+		default:
+			panic(fmt.Errorf("invalid escape %q, %w", text[i-1:i+1], errParse))
+		}
+	}
+
+	return b.String()
+}
+
 // Parse the arguments of a copy or cut operation from the permascroll.
-func parseCopyCut(source *int) (op operation, match [][]byte) {
+func (ps *Permascroll) parseCopyCut(source *int) (op operation, match [][]byte) {
 	op.code = 'C'
-	match = ccRx.FindSubmatch(permascroll[*source:])
+	match = ccRx.FindSubmatch(ps.permascroll[*source:])
 	if match == nil {
 		return op, match
 	}
 
 	if match[3][0] == ':' {
-		op.text1 = string(match[4])
+		op.text1 = ps.unescape(match[4])
 	} else {
 		var err error
 		if op.size1, err = strconv.Atoi(string(match[4])); err != nil {
@@ -476,9 +818,9 @@ func parseCopyCut(source *int) (op operation, match [][]byte) {
 }
 
 // Parse the arguments of an exchange operation from the permascroll.
-func parseExchange(source *int) (op operation, match [][]byte) {
+func (ps *Permascroll) parseExchange(source *int) (op operation, match [][]byte) {
 	op.code = 'X'
-	match = exRx.FindSubmatch(permascroll[*source:])
+	match = exRx.FindSubmatch(ps.permascroll[*source:])
 	if match == nil {
 		return op, match
 	}
@@ -498,13 +840,14 @@ type operation struct {
 	pn, offset1, size1, offset2, size2 int
 	text1, text2                       string
 	ts                                 time.Time
+	ends                               []linkEnd // Ends of a link
 }
 
 // Parse an operation from the permascroll.
-func parseOperation(source *int) (delta int, op operation) {
-	match := opRx.FindSubmatch(permascroll[*source:])
+func (ps *Permascroll) parseOperation(source *int) (delta int, op operation) {
+	match := opRx.FindSubmatch(ps.permascroll[*source:])
 	if match == nil {
-		panic(fmt.Errorf("invalid operation %q, %w", permascroll[*source], errParse))
+		panic(fmt.Errorf("invalid operation %q, %w", ps.permascroll[*source], errParse))
 	}
 	*source += len(match[0])
 
@@ -516,21 +859,29 @@ func parseOperation(source *int) (delta int, op operation) {
 	op.code = match[3][0]
 	switch op.code {
 	case 'C':
-		op, match = parseCopyCut(source)
-		op.ts = parseTime(ts)
+		op, match = ps.parseCopyCut(source)
+	case 'L':
+		op, match = ps.parseLink(source)
 	case 'D', 'I':
-		if match = diRx.FindSubmatch(permascroll[*source:]); match != nil {
-			op.text1 = string(match[3])
+		if match = diRx.FindSubmatch(ps.permascroll[*source:]); match != nil {
+			op.text1 = ps.unescape(match[3])
 		}
 	case 'R':
-		if match = reRx.FindSubmatch(permascroll[*source:]); match != nil {
-			op.text1 = string(match[3])
-			op.text2 = string(match[4])
+		if match = reRx.FindSubmatch(ps.permascroll[*source:]); match != nil {
+			op.text1 = ps.unescape(match[3])
+			op.text2 = ps.unescape(match[4])
 		}
 	case 'M', 'S':
-		match = msRx.FindSubmatch(permascroll[*source:])
+		match = msRx.FindSubmatch(ps.permascroll[*source:])
+	case 'P':
+		if match = mvRx.FindSubmatch(ps.permascroll[*source:]); match != nil {
+			op.size1, _ = strconv.Atoi(string(match[2]))
+			op.offset2, _ = strconv.Atoi(string(match[3]))
+		}
+	case 'T':
+		op, match = ps.parseTransclusion(source)
 	default: // 'X'
-		op, match = parseExchange(source)
+		op, match = ps.parseExchange(source)
 	}
 
 	if match == nil {
@@ -539,41 +890,66 @@ func parseOperation(source *int) (delta int, op operation) {
 
 	*source += len(match[0])
 	op.pn, _ = strconv.Atoi(string(match[1]))
+	op.ts = ps.parseTime(ts)
 
-	if op.code != 'X' {
+	if op.code != 'P' && op.code != 'X' {
 		op.offset1, _ = strconv.Atoi(string(match[2]))
 	}
 
 	return delta, op
 }
 
+// Check the permascroll format descriptor and select the corresponding format.
+func (ps *Permascroll) parseMagic() bool {
+	switch {
+	case bytes.HasPrefix(ps.permascroll, []byte(magic)):
+		ps.legacy = false
+	case bytes.HasPrefix(ps.permascroll, []byte(magicV0)):
+		ps.legacy = true
+	default:
+		return false
+	}
+
+	return true
+}
+
 // Parse the entire permascroll.
-func parsePermascroll() {
-	if len(permascroll) < len(magic) || !bytes.Equal(permascroll[:len(magic)], []byte(magic)) {
+func (ps *Permascroll) parsePermascroll() {
+	if !ps.parseMagic() {
 		panic(fmt.Errorf("invalid magic, %w", errParse))
 	}
 
-	source := len(magic)
-	for source < len(permascroll) {
-		opSource := source
-		delta, op := parseOperation(&source)
-		for range delta {
-			docUndo()
-		}
-		docRedo(op)
-		newVersion(opSource)
+	ps.replay(len(magic))
+}
+
+// Replay the operations in the permascroll starting from source.
+func (ps *Permascroll) replay(source int) {
+	for source < len(ps.permascroll) {
+		ps.replayOperation(&source)
 	}
 }
 
-func parseTime(s string) (ts time.Time) {
-	if len(s) == 0 {
-		return ts
+// Replay the operation at source and advance source past it.
+func (ps *Permascroll) replayOperation(source *int) {
+	next := *source
+	delta, op := ps.parseOperation(&next)
+	ps.GotoVersion(len(ps.history) - 1 - delta) // Skip back to the parent, which may be on another branch
+	ps.validateOperation(op)
+	ps.docRedo(op)
+	ps.newVersion(*source, op.ts)
+	if !op.ts.IsZero() {
+		ps.lastTime = op.ts
 	}
 
-	if len(cut) > 0 {
-		ts = cut[len(cut)-1].ts
+	*source = next
+}
+
+func (ps *Permascroll) parseTime(s string) (ts time.Time) {
+	if len(s) == 0 {
+		return ts
 	}
 
+	ts = ps.lastTime
 	if ts.IsZero() {
 		ts = epoch
 	}
@@ -588,66 +964,102 @@ func parseTime(s string) (ts time.Time) {
 	return ts
 }
 
-func ReplaceText(pn, pos, end int, text string) {
-	validateSpan(pn, pos, end)
+// Replace text in a paragraph between pos and end.
+func (ps *Permascroll) ReplaceText(pn, pos, end int, text string) {
+	ps.validateSpan(pn, pos, end)
 
-	Flush()
-	paragraph, offset = pn, pos
-	d := document[paragraph-1][offset:end]
-	docReplace(end-offset, text)
-	persist(fmt.Sprintf("R%d,%d:%s\t%s", paragraph, pos, d, text))
+	ps.Flush()
+	ps.paragraph, ps.offset = pn, pos
+	d := ps.document[ps.paragraph-1][ps.offset:end]
+	ps.docReplace(end-ps.offset, text)
+	ps.persist(clock(), fmt.Sprintf("R%d,%d:%s\t%s", ps.paragraph, pos, ps.escape(d), ps.escape(text)))
 }
 
 // Redo the last undone operation, if any.
-func Redo() (code byte) {
-	child := history[current].lastChild
-	if child > 0 && deleting == 0 && len(pending) == 0 {
-		current = child
-		source := history[current].source
-		_, op := parseOperation(&source)
-		docRedo(op)
-		code = op.code
+func (ps *Permascroll) Redo() (code byte) {
+	child := ps.history[ps.current].lastChild
+	if child > 0 && ps.deleting == 0 && len(ps.pending) == 0 {
+		code = ps.redoVersion(child)
 	}
 
 	return code
 }
 
+// The paragraph and offset size bytes after the current position, where each
+// paragraph break counts as a single byte.
+func (ps *Permascroll) spanEnd(size int) (epn, end int) {
+	epn, end = ps.paragraph, ps.offset+size
+	for end > len(ps.document[epn-1]) {
+		end -= len(ps.document[epn-1]) + 1
+		epn++
+	}
+
+	return epn, end
+}
+
+// True if operations can span paragraphs, which the original format does not
+// support.
+func (ps *Permascroll) SpansParagraphs() bool { return !ps.legacy }
+
 // Split a paragraph at a specified position.
-func SplitParagraph(pn, pos int) {
-	validatePos(pn, pos)
+func (ps *Permascroll) SplitParagraph(pn, pos int) {
+	ps.validatePos(pn, pos)
 
-	Flush()
-	paragraph, offset = pn, pos
-	docSplit()
-	persist(fmt.Sprintf("S%d,%d", pn, pos))
+	ps.Flush()
+	ps.paragraph, ps.offset = pn, pos
+	ps.docSplit()
+	ps.persist(clock(), fmt.Sprintf("S%d,%d", pn, pos))
 }
 
 // Undo the immediately preceding operation, if any.
-func Undo() (op byte) {
-	if current > 0 {
-		Flush()
-		op = docUndo()
+func (ps *Permascroll) Undo() (op byte) {
+	if ps.current > 0 {
+		ps.Flush()
+		op = ps.docUndo()
 	}
 
 	return op
 }
 
-func validatePn(pn int) {
-	if pn < 1 || pn > len(document) {
+func (ps *Permascroll) validatePn(pn int) {
+	if pn < 1 || pn > len(ps.document) {
 		panic(fmt.Errorf("paragraph '%d' %w", pn, errRange))
 	}
 }
 
-func validatePos(pn, pos int) {
-	validatePn(pn)
-	if pos < 0 || pos > len(document[pn-1])+len(pending) {
+func (ps *Permascroll) validateMove(pn, count, dest int) {
+	ps.validatePn(pn)
+	if count < 1 || pn+count-1 > len(ps.document) {
+		panic(fmt.Errorf("count '%d' %w", count, errRange))
+	}
+
+	if dest < 1 || dest == pn || dest+count-1 > len(ps.document) {
+		panic(fmt.Errorf("destination '%d' %w", dest, errRange))
+	}
+}
+
+func (ps *Permascroll) validatePos(pn, pos int) {
+	ps.validatePn(pn)
+	if pos < 0 || pos > len(ps.document[pn-1])+len(ps.pending) {
 		panic(fmt.Errorf("pos '%d,%d' %w", pn, pos, errRange))
 	}
 }
 
-func validateSpan(pn, pos, end int) {
-	validatePos(pn, pos)
-	if end <= pos || end > len(document[pn-1])+len(pending)+1 {
+func (ps *Permascroll) validateRange(pn, pos, epn, end int) {
+	ps.validatePos(pn, pos)
+	ps.validatePos(epn, end)
+	if epn < pn || (epn == pn && end <= pos) {
+		panic(fmt.Errorf("end '%d,%d-%d,%d' %w", pn, pos, epn, end, errRange))
+	}
+
+	if ps.legacy {
+		panic(fmt.Errorf("span '%d-%d' %w", pn, epn, errLegacy))
+	}
+}
+
+func (ps *Permascroll) validateSpan(pn, pos, end int) {
+	ps.validatePos(pn, pos)
+	if end <= pos || end > len(ps.document[pn-1])+len(ps.pending)+1 {
 		panic(fmt.Errorf("end '%d,%d-%d' %w", pn, pos, end, errRange))
 	}
 }
@@ -5,10 +5,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/stretchr/testify/assert"
 )
 
 func init() {
+	clock = func() time.Time { return epoch }
 	if err := OpenPermascroll(os.DevNull); err != nil {
 		panic(err)
 	}
@@ -17,15 +19,32 @@ func init() {
 func TestInit(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
-	assert.Equal([]string{""}, document)
-	assert.Equal(magic, string(permascroll))
+	assert.Equal([]string{""}, std.document)
+	assert.Equal(magic, string(std.permascroll))
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+	draft, notes := New("I1,0:Draft\n"), New("")
+	draft.file, notes.file = &mockFileType{}, &mockFileType{}
+
+	notes.AppendText(1, "Notes")
+	notes.SplitParagraph(1, 5)
+	draft.Undo()
+	assert.Equal([]string{""}, draft.document)
+	assert.Equal([]string{"Notes", ""}, notes.document)
+	assert.Equal(2, notes.current)
+
+	draft.Redo()
+	assert.Equal("Draft", draft.GetText(1))
+	assert.Equal(magic+"+0I1,0:Notes\n+0S1,5\n", string(notes.permascroll))
 }
 
 func TestAppendText(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
 	AppendText(1, "Test")
-	assert.Equal("Test", pending)
+	assert.Equal("Test", std.pending)
 }
 
 func TestCopyText(t *testing.T) {
@@ -36,6 +55,45 @@ func TestCopyText(t *testing.T) {
 	assert.Equal(1, CopyText(1, 0, 4)) // Copy repeated
 }
 
+func TestCopySpan(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One\nS1,3\nI2,0:Two\nS2,3\nI3,0:Three\n")
+
+	assert.PanicsWithError("end '2,1-1,0' out of range", func() { CopySpan(2, 1, 1, 0) })
+	assert.Equal(1, CopySpan(1, 1, 1, 3))
+	assert.Equal(2, CopySpan(1, 1, 3, 2))
+	assert.Equal(2, CopySpan(1, 1, 3, 2)) // Copy repeated
+	text, _ := GetCut(2)
+	assert.Equal("ne\nTwo\nTh", text)
+	assert.Contains(string(std.permascroll), "+0C1,1+9\n")
+
+	Init(string(std.permascroll[len(magic):]))
+	text, _ = GetCut(2)
+	assert.Equal("ne\nTwo\nTh", text)
+}
+
+func TestCutSpan(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One\nS1,3\nI2,0:Two\nS2,3\nI3,0:Three\n")
+
+	assert.Equal(1, CutSpan(2, 1, 2, 2))
+	assert.Equal(2, CutSpan(1, 1, 3, 2))
+	assert.Equal([]string{"Oree"}, std.document)
+	assert.Equal(1, Paragraphs())
+	text, _ := GetCut(2)
+	assert.Equal("ne\nTo\nTh", text)
+	assert.Contains(string(std.permascroll), "+0C1,1:ne\\nTo\\nTh\n")
+
+	Undo()
+	assert.Equal([]string{"One", "To", "Three"}, std.document)
+	Redo()
+	assert.Equal([]string{"Oree"}, std.document)
+
+	Init(string(std.permascroll[len(magic):]))
+	assert.Equal([]string{"Oree"}, std.document)
+	assert.Equal(2, Cuts())
+}
+
 func TestCutText(t *testing.T) {
 	assert := assert.New(t)
 	Init("I1,0:Tested\n")
@@ -44,18 +102,43 @@ func TestCutText(t *testing.T) {
 	assert.Equal(1, CutText(1, 1, 2)) // Cut 'e' repeated
 }
 
-func TestCutTime(t *testing.T) {
+func TestEncodeTime(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
 
-	docCopy("1", epoch.Add(3*time.Millisecond))
-	assert.Equal("+3", cutTime())
+	ts, s := std.encodeTime(epoch.Add(3*time.Millisecond + time.Microsecond))
+	assert.Equal(epoch.Add(3*time.Millisecond), ts)
+	assert.Equal("+3", s)
+
+	std.lastTime = ts
+	ts, s = std.encodeTime(ts.Add(2*time.Minute + time.Second))
+	assert.Equal(epoch.Add(2*time.Minute+3*time.Millisecond), ts)
+	assert.Equal("@2", s)
+
+	_, s = std.encodeTime(epoch) // Clock set backwards
+	assert.Equal("+0", s)
+}
+
+func TestEscape(t *testing.T) {
+	tests := map[string]struct{ text, escaped string }{
+		"plain":     {"Test ¶", "Test ¶"},
+		"backslash": {`a\b`, `a\\b`},
+		"tab":       {"a\tb", `a\tb`},
+		"newline":   {"a\nb", `a\nb`},
+		"control":   {"\x00\r\x1f\x7f", `\x00\x0d\x1f\x7f`},
+	}
 
-	docCopy("2", epoch.Add(2*time.Minute+time.Second))
-	assert.Equal("@2", cutTime())
+	for name, test := range tests {
+		t.Run(name, func(_ *testing.T) {
+			assert.Equal(t, test.escaped, std.escape(test.text), name)
+			assert.Equal(t, test.text, std.unescape([]byte(test.escaped)), name)
+		})
+	}
 
-	cut[0].ts = time.Time{}
-	assert.Equal("@2", cutTime())
+	std.legacy = true
+	defer func() { std.legacy = false }()
+	assert.Equal(t, "a\tb\\", std.escape("a\tb\\"))
+	assert.Equal(t, `a\tb`, std.unescape([]byte(`a\tb`)))
 }
 
 func TestDeleteText(t *testing.T) {
@@ -82,37 +165,63 @@ func TestDeleteText(t *testing.T) {
 			}
 
 			DeleteText(test.pn, test.pos, test.end)
-			assert.Equal(test.pos, offset)
-			assert.Equal(test.deleting, deleting)
+			assert.Equal(test.pos, std.offset)
+			assert.Equal(test.deleting, std.deleting)
 		})
 	}
 
 	Init("")
 	InsertText(1, 0, "Test")
 	DeleteText(1, 1, 2)
-	assert.Equal("Tst", pending)
-	assert.Equal(0, offset)
-	assert.Equal(0, deleting)
+	assert.Equal("Tst", std.pending)
+	assert.Equal(0, std.offset)
+	assert.Equal(0, std.deleting)
 
 	Flush()
 	DeleteText(1, 1, 2)
 	DeleteText(1, 1, 2)
-	assert.Equal(1, offset)
-	assert.Equal(2, deleting)
+	assert.Equal(1, std.offset)
+	assert.Equal(2, std.deleting)
+}
+
+func TestDeleteSpan(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One\nS1,3\nI2,0:Two\nD1,1:n\nD1,2:\\nT\n")
+	assert.Equal([]string{"Oewo"}, std.document)
+
+	Undo()
+	assert.Equal([]string{"Oe", "Two"}, std.document)
+	assert.Equal(2, std.paragraph)
+	Redo()
+	assert.Equal([]string{"Oewo"}, std.document)
+
+	std.legacy = true
+	defer func() { std.legacy = false }()
+	SplitParagraph(1, 1)
+	assert.PanicsWithError("span '1-2' unsupported by JottyV0", func() { CutSpan(1, 0, 2, 1) })
+	assert.PanicsWithError("paragraph break unsupported by JottyV0", func() { InsertText(1, 0, "A\nB") })
+	assert.False(SpansParagraphs())
 }
 
 func TestDocCopy(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
 
-	assert.Equal(0, docCopy("1", time.Time{}))
-	assert.Equal(0, docCopy("2", time.Time{}))
-	assert.Equal(1, docCopy("1", time.Time{}))
+	assert.Equal(0, std.docCopy("1", time.Time{}))
+	assert.Equal(0, std.docCopy("2", time.Time{}))
+	assert.Equal(1, std.docCopy("1", time.Time{}))
+
+	// A cut whose hash collides with that of another cut is still copied
+	std.cutHash[xxhash.Sum64String("3")] = 0
+	assert.Equal(0, std.docCopy("3", time.Time{}))
+	assert.Equal("3", std.cut[2].text)
+	assert.Equal(0, std.cutHash[xxhash.Sum64String("3")])
+	assert.Equal(3, std.docCopy("3", time.Time{}))
 }
 
 func TestDocDelete(t *testing.T) {
 	assert := assert.New(t)
-	paragraph = 1
+	std.paragraph = 1
 	tests := map[string]struct {
 		offset, size int
 		expect       string
@@ -120,17 +229,17 @@ func TestDocDelete(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
-			document = []string{"Test"}
-			offset = test.offset
-			docDelete(test.size)
-			assert.Equal(test.expect, document[0])
+			std.document = []string{"Test"}
+			std.offset = test.offset
+			std.docDelete(test.size)
+			assert.Equal(test.expect, std.document[0])
 		})
 	}
 }
 
 func TestDocExchange(t *testing.T) {
 	assert := assert.New(t)
-	paragraph = 2
+	std.paragraph = 2
 	tests := map[string]struct {
 		begin1, end1, begin2, end2 int
 		expect                     []string
@@ -143,21 +252,21 @@ func TestDocExchange(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {})
-		document = []string{"Test", "strings"}
-		docHash = []uint64{0, 0}
-		docExchange(span{test.begin1, test.end1}, span{test.begin2, test.end2})
-		assert.Equal(test.expect, document)
+		std.document = []string{"Test", "strings"}
+		std.docHash = []uint64{0, 0}
+		std.docExchange(span{test.begin1, test.end1}, span{test.begin2, test.end2})
+		assert.Equal(test.expect, std.document)
 	}
 }
 
 func TestDocReplace(t *testing.T) {
 	assert := assert.New(t)
-	document = []string{"Test"}
-	docHash = []uint64{0}
-	paragraph, offset = 1, 1
-	docReplace(1, "12")
-	assert.Equal([]string{"T12st"}, document)
-	assert.Equal(3, offset)
+	std.document = []string{"Test"}
+	std.docHash = []uint64{0}
+	std.paragraph, std.offset = 1, 1
+	std.docReplace(1, "12")
+	assert.Equal([]string{"T12st"}, std.document)
+	assert.Equal(3, std.offset)
 }
 
 func TestExchangeParagraphs(t *testing.T) {
@@ -167,46 +276,46 @@ func TestExchangeParagraphs(t *testing.T) {
 	Init("I1,0:OneTwo\nS1,3\n")
 
 	ExchangeParagraphs(2)
-	assert.Equal(3, current)
-	assert.Equal([]string{"Two", "One"}, document)
-	expect := magic + "I1,0:OneTwo\nS1,3\nX2\n"
-	assert.Equal(expect, string(permascroll))
+	assert.Equal(3, std.current)
+	assert.Equal([]string{"Two", "One"}, std.document)
+	expect := magic + "I1,0:OneTwo\nS1,3\n+0X2\n"
+	assert.Equal(expect, string(std.permascroll))
 
 	ExchangeParagraphs(2)
-	assert.Equal(2, current)
-	assert.Equal([]string{"One", "Two"}, document)
-	assert.Equal(expect, string(permascroll))
+	assert.Equal(2, std.current)
+	assert.Equal([]string{"One", "Two"}, std.document)
+	assert.Equal(expect, string(std.permascroll))
 
 	ExchangeParagraphs(2)
-	assert.Equal(3, current)
-	assert.Equal([]string{"Two", "One"}, document)
-	assert.Equal(expect, string(permascroll))
+	assert.Equal(3, std.current)
+	assert.Equal([]string{"Two", "One"}, std.document)
+	assert.Equal(expect, string(std.permascroll))
 }
 
 func TestExchangeText(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
 
-	docInsert("Test")
+	std.docInsert("Test")
 	assert.PanicsWithError("overlap '1-3/2-4' out of range", func() { ExchangeText(1, 1, 3, 2, 4) })
 
 	ExchangeText(1, 1, 4, 0, 1)
-	assert.Equal("estT", document[0])
-	expect := magic + "X1,0+1/1+3\n"
-	assert.Equal(expect, string(permascroll))
+	assert.Equal("estT", std.document[0])
+	expect := magic + "+0X1,0+1/1+3\n"
+	assert.Equal(expect, string(std.permascroll))
 
 	ExchangeText(1, 1, 2, 3, 4)
-	assert.Equal("eTts", document[0])
-	expect += "X1,1+1/3+1\n"
-	assert.Equal(expect, string(permascroll))
+	assert.Equal("eTts", std.document[0])
+	expect += "+0X1,1+1/3+1\n"
+	assert.Equal(expect, string(std.permascroll))
 
 	ExchangeText(1, 1, 2, 3, 4)
-	assert.Equal("estT", document[0])
-	assert.Equal(expect, string(permascroll))
+	assert.Equal("estT", std.document[0])
+	assert.Equal(expect, string(std.permascroll))
 
 	ExchangeText(1, 1, 2, 3, 4)
-	assert.Equal("eTts", document[0])
-	assert.Equal(expect, string(permascroll))
+	assert.Equal("eTts", std.document[0])
+	assert.Equal(expect, string(std.permascroll))
 }
 
 func TestFlushDeleting(t *testing.T) {
@@ -215,20 +324,20 @@ func TestFlushDeleting(t *testing.T) {
 		offset, deleting  int
 		para, permascroll string
 	}{
-		"Beginning": {0, 1, "est", "D1,0:T\n"},
-		"Middle":    {1, 1, "Tst", "D1,1:e\n"},
-		"End":       {3, 1, "Tes", "D1,3:t\n"},
+		"Beginning": {0, 1, "est", "+0D1,0:T\n"},
+		"Middle":    {1, 1, "Tst", "+0D1,1:e\n"},
+		"End":       {3, 1, "Tes", "+0D1,3:t\n"},
 		"All":       {0, 4, "", ""},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
 			Init("")
-			docInsert("Test")
-			offset, deleting = test.offset, test.deleting
+			std.docInsert("Test")
+			std.offset, std.deleting = test.offset, test.deleting
 			Flush()
-			assert.Equal(test.para, document[0])
-			assert.Equal(magic+test.permascroll, string(permascroll))
+			assert.Equal(test.para, std.document[0])
+			assert.Equal(magic+test.permascroll, string(std.permascroll))
 		})
 	}
 }
@@ -238,30 +347,30 @@ func TestFlushInserting(t *testing.T) {
 	Init("")
 
 	Flush()
-	assert.Equal([]string{""}, document)
+	assert.Equal([]string{""}, std.document)
 
-	pending = "Test"
+	std.pending = "Test"
 	Flush()
-	assert.Equal([]string{"Test"}, document)
-	assert.Equal(magic+"I1,0:Test\n", string(permascroll))
+	assert.Equal([]string{"Test"}, std.document)
+	assert.Equal(magic+"+0I1,0:Test\n", string(std.permascroll))
 
 	tests := map[string]struct {
 		offset            int
 		para, permascroll string
 	}{
-		"Beginning": {0, "NewTest", "I1,0:New"},
-		"Middle":    {2, "TeNewst", "I1,2:New"},
-		"End":       {4, "TestNew", "I1,4:New"},
+		"Beginning": {0, "NewTest", "+0I1,0:New"},
+		"Middle":    {2, "TeNewst", "+0I1,2:New"},
+		"End":       {4, "TestNew", "+0I1,4:New"},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
 			Init("")
-			docInsert("Test")
-			offset, pending = test.offset, "New"
+			std.docInsert("Test")
+			std.offset, std.pending = test.offset, "New"
 			Flush()
-			assert.Equal(test.para, document[0])
-			assert.Equal(magic+test.permascroll+"\n", string(permascroll))
+			assert.Equal(test.para, std.document[0])
+			assert.Equal(magic+test.permascroll+"\n", string(std.permascroll))
 		})
 	}
 }
@@ -276,15 +385,15 @@ func TestGetSize(t *testing.T) {
 func TestGetText(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
-	pending = "Two "
+	std.pending = "Two "
 	Flush()
-	pending, offset = "words", 4
+	std.pending, std.offset = "words", 4
 	assert.Equal("Two words", GetText(1))
 
 	Flush()
 	assert.Equal("Two words", GetText(1))
 
-	deleting, offset = 1, 4
+	std.deleting, std.offset = 1, 4
 	assert.Equal("Two ords", GetText(1))
 }
 
@@ -295,7 +404,7 @@ func TestInsertText(t *testing.T) {
 	InsertText(1, 3, "Two")
 	InsertText(1, 0, "Three")
 	InsertText(1, 5, "Four")
-	assert.Equal("ThreeFourOneTwo", pending)
+	assert.Equal("ThreeFourOneTwo", std.pending)
 
 	SplitParagraph(1, 15)
 	AppendText(2, "Five")
@@ -303,8 +412,8 @@ func TestInsertText(t *testing.T) {
 	InsertText(2, 4, "Seven")
 	Flush()
 	InsertText(2, 4, "Eight")
-	assert.Equal([]string{"ThreeFourSixOneTwo", "FiveSeven"}, document)
-	assert.Equal(magic+"I1,0:ThreeFourOneTwo\nS1,15\nI2,0:Five\nI1,9:Six\nI2,4:Seven\n", string(permascroll))
+	assert.Equal([]string{"ThreeFourSixOneTwo", "FiveSeven"}, std.document)
+	assert.Equal(magic+"+0I1,0:ThreeFourOneTwo\n+0S1,15\n+0I2,0:Five\n+0I1,9:Six\n+0I2,4:Seven\n", string(std.permascroll))
 	assert.Equal("ThreeFourSixOneTwo", GetText(1))
 	assert.Equal("FiveEightSeven", GetText(2))
 
@@ -314,12 +423,65 @@ func TestInsertText(t *testing.T) {
 	assert.Equal("ThreeNineSixOneTwoTen", GetText(1))
 }
 
+func TestInsertParagraphs(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:OneTwo\n")
+
+	InsertText(1, 3, "A\nB\nC")
+	assert.Equal([]string{"OneA", "B", "CTwo"}, std.document)
+	p, o := GetPos()
+	assert.Equal(3, p)
+	assert.Equal(1, o)
+	assert.Contains(string(std.permascroll), "+0I1,3:A\\nB\\nC\n")
+	assert.True(SpansParagraphs())
+
+	InsertText(3, 0, "\n")
+	assert.Equal([]string{"OneA", "B", "", "CTwo"}, std.document)
+
+	Undo()
+	Undo()
+	assert.Equal([]string{"OneTwo"}, std.document)
+	assert.Equal(New("I1,0:OneTwo\n").docHash, std.docHash)
+}
+
 func TestReplaceText(t *testing.T) {
 	assert := assert.New(t)
 	Init("I1,0:Test\n")
 	ReplaceText(1, 2, 3, "12")
-	assert.Equal([]string{"Te12t"}, document)
-	assert.Equal(magic+"I1,0:Test\nR1,2:s\t12\n", string(permascroll))
+	assert.Equal([]string{"Te12t"}, std.document)
+	assert.Equal(magic+"I1,0:Test\n+0R1,2:s\t12\n", string(std.permascroll))
+}
+
+func TestMoveParagraphs(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One\\nTwo\\nThree\\nFour\\nFive\n")
+
+	assert.PanicsWithError("paragraph '6' out of range", func() { MoveParagraphs(6, 1, 1) })
+	assert.PanicsWithError("count '3' out of range", func() { MoveParagraphs(4, 3, 1) })
+	assert.PanicsWithError("destination '2' out of range", func() { MoveParagraphs(2, 1, 2) })
+	assert.PanicsWithError("destination '4' out of range", func() { MoveParagraphs(1, 3, 4) })
+
+	MoveParagraphs(4, 2, 1)
+	assert.Equal([]string{"Four", "Five", "One", "Two", "Three"}, std.document)
+	assert.Contains(string(std.permascroll), "+0P4+2:1\n")
+	p, o := GetPos()
+	assert.Equal([]int{1, 0}, []int{p, o})
+	assert.Equal(VersionInfo{Code: 'P', Created: epoch, Paragraph: 4, Parent: 1, Target: 1, Time: epoch}, GetVersion(2))
+
+	replayed := New(string(std.permascroll[len(magic):]))
+	assert.Equal(std.document, replayed.document)
+
+	Undo()
+	assert.Equal([]string{"One", "Two", "Three", "Four", "Five"}, std.document)
+	assert.Equal(1, std.current)
+
+	MoveParagraphs(1, 1, 5)
+	assert.Equal([]string{"Two", "Three", "Four", "Five", "One"}, std.document)
+	assert.Equal(std.docHash, New("I1,0:Two\\nThree\\nFour\\nFive\\nOne\n").docHash)
+
+	std.legacy = true
+	assert.PanicsWithError("move unsupported by JottyV0", func() { MoveParagraphs(1, 1, 2) })
+	std.legacy = false
 }
 
 func TestMergeParagraph(t *testing.T) {
@@ -327,7 +489,7 @@ func TestMergeParagraph(t *testing.T) {
 
 	Init("")
 	MergeParagraph(1)
-	assert.Equal([]string{""}, document)
+	assert.Equal([]string{""}, std.document)
 
 	tests := map[string]struct {
 		document []string
@@ -343,11 +505,11 @@ func TestMergeParagraph(t *testing.T) {
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
 			Init("")
-			document = test.document
-			docHash = []uint64{0, 0}
+			std.document = test.document
+			std.docHash = []uint64{0, 0}
 			MergeParagraph(1)
-			assert.Equal(test.para, document[0])
-			assert.Equal(test.offset, offset)
+			assert.Equal(test.para, std.document[0])
+			assert.Equal(test.offset, std.offset)
 		})
 	}
 }
@@ -355,31 +517,31 @@ func TestMergeParagraph(t *testing.T) {
 func TestParseCopyCut(t *testing.T) {
 	assert := assert.New(t)
 
-	permascroll = []byte(magic + "Cinvalid\n")
+	std.permascroll = []byte(magic + "Cinvalid\n")
 	source := len(magic) + 1
-	op, match := parseCopyCut(&source)
+	op, match := std.parseCopyCut(&source)
 	assert.Equal(operation{code: 'C'}, op)
 	assert.Nil(match)
 
-	permascroll = []byte(magic + "C1,0+x\n")
+	std.permascroll = []byte(magic + "C1,0+x\n")
 	source = len(magic) + 1
 	assert.PanicsWithError(`invalid size for 'C', strconv.Atoi: parsing "x": invalid syntax`,
-		func() { parseCopyCut(&source) })
+		func() { std.parseCopyCut(&source) })
 
 	tests := map[string]struct {
 		arguments string
 		op        operation
 		pn        string
 	}{
-		"Copy": {"1,2+3", operation{'C', 0, 0, 3, 0, 0, "", "", time.Time{}}, "1"},
-		"Cut":  {"4,5:Test", operation{'C', 0, 0, 0, 0, 0, "Test", "", time.Time{}}, "4"},
+		"Copy": {"1,2+3", operation{'C', 0, 0, 3, 0, 0, "", "", time.Time{}, nil}, "1"},
+		"Cut":  {"4,5:Test", operation{'C', 0, 0, 0, 0, 0, "Test", "", time.Time{}, nil}, "4"},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
-			permascroll = []byte(magic + "C" + test.arguments + "\n")
+			std.permascroll = []byte(magic + "C" + test.arguments + "\n")
 			source := len(magic) + 1
-			op, match := parseCopyCut(&source)
+			op, match := std.parseCopyCut(&source)
 			assert.Equal(test.op, op)
 			assert.Equal(test.pn, string(match[1]))
 		})
@@ -389,9 +551,9 @@ func TestParseCopyCut(t *testing.T) {
 func TestParseExchange(t *testing.T) {
 	assert := assert.New(t)
 
-	permascroll = []byte(magic + "Xinvalid\n")
+	std.permascroll = []byte(magic + "Xinvalid\n")
 	source := len(magic) + 1
-	op, match := parseExchange(&source)
+	op, match := std.parseExchange(&source)
 	assert.Equal(operation{code: 'X'}, op)
 	assert.Nil(match)
 
@@ -401,14 +563,14 @@ func TestParseExchange(t *testing.T) {
 		pn        string
 	}{
 		"Paragraph": {"2", operation{code: 'X'}, "2"},
-		"Text":      {"1,0+1/2+3", operation{'X', 0, 0, 1, 2, 3, "", "", time.Time{}}, "1"},
+		"Text":      {"1,0+1/2+3", operation{'X', 0, 0, 1, 2, 3, "", "", time.Time{}, nil}, "1"},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
-			permascroll = []byte(magic + "X" + test.arguments + "\n")
+			std.permascroll = []byte(magic + "X" + test.arguments + "\n")
 			source := len(magic) + 1
-			op, match := parseExchange(&source)
+			op, match := std.parseExchange(&source)
 			assert.Equal(test.op, op)
 			assert.Equal(test.pn, string(match[1]))
 		})
@@ -436,8 +598,8 @@ func TestParseOperation(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
-			source := history[test.i].source
-			delta, op := parseOperation(&source)
+			source := std.history[test.i].source
+			delta, op := std.parseOperation(&source)
 			assert.Equal(0, delta)
 			assert.Equal(test.code, op.code)
 			assert.Equal(test.text1, op.text1)
@@ -449,42 +611,80 @@ func TestParseOperation(t *testing.T) {
 func TestParsePermascroll(t *testing.T) {
 	assert := assert.New(t)
 
-	permascroll = []byte{}
-	assert.PanicsWithError(`invalid magic, parse failed`, func() { parsePermascroll() })
+	std.permascroll = []byte{}
+	assert.PanicsWithError(`invalid magic, parse failed`, func() { std.parsePermascroll() })
 
-	permascroll = []byte("bad magic\n")
-	assert.PanicsWithError(`invalid magic, parse failed`, func() { parsePermascroll() })
+	std.permascroll = []byte("bad magic\n")
+	assert.PanicsWithError(`invalid magic, parse failed`, func() { std.parsePermascroll() })
 
-	permascroll = []byte(magic + "bad\n")
-	assert.PanicsWithError(`invalid operation 'b', parse failed`, func() { parsePermascroll() })
+	std.permascroll = []byte(magic + "bad\n")
+	assert.PanicsWithError(`invalid operation 'b', parse failed`, func() { std.parsePermascroll() })
 
-	permascroll = []byte(magic + "I:bad\n")
-	assert.PanicsWithError(`invalid arguments for 'I', parse failed`, func() { parsePermascroll() })
+	std.permascroll = []byte(magic + "I:bad\n")
+	assert.PanicsWithError(`invalid arguments for 'I', parse failed`, func() { std.parsePermascroll() })
 
-	permascroll = []byte(magic + "R1,0:bad\n")
-	assert.PanicsWithError(`invalid arguments for 'R', parse failed`, func() { parsePermascroll() })
+	std.permascroll = []byte(magic + "R1,0:bad\n")
+	assert.PanicsWithError(`invalid arguments for 'R', parse failed`, func() { std.parsePermascroll() })
+
+	std.permascroll = []byte(magic + "I1,0:bad\\\n")
+	assert.PanicsWithError(`invalid escape at end, parse failed`, func() { std.parsePermascroll() })
+
+	std.permascroll = []byte(magic + "I1,0:\\q\n")
+	assert.PanicsWithError(`invalid escape "\\q", parse failed`, func() { std.parsePermascroll() })
+
+	std.permascroll = []byte(magic + "I1,0:\\x4\n")
+	assert.PanicsWithError(`invalid escape "\\x4", parse failed`, func() { std.parsePermascroll() })
+
+	std.permascroll = []byte(magic + "I1,0:\\xzz\n")
+	assert.PanicsWithError(`invalid escape "\\xzz", parse failed`, func() { std.parsePermascroll() })
+
+	Init("")
+	assert.Equal([]version{{}}, std.history)
+
+	std.permascroll = []byte(magic + "S1,0\nI1,0:Test\n2I1,0:Two\n@3C1,0+3\n")
+	std.parsePermascroll()
+	assert.Equal(4, std.current)
+	assert.Equal([]cutType{{"Two", epoch.Add(3 * time.Minute)}}, std.cut)
+	assert.Equal([]string{"Two"}, std.document)
+	assert.Equal([]version{{0, 0, 3}, {8, 0, 2}, {13, 1, 0}, {23, 0, 4}, {33, 3, 0}}, std.history)
+}
+
+func TestParseLegacy(t *testing.T) {
+	assert := assert.New(t)
+	mockFile = &mockFileType{}
+	std.file = mockFile
 
 	Init("")
-	assert.Equal([]version{{}}, history)
+	std.permascroll = []byte(magicV0 + "I1,0:a\\tb\n")
+	std.parsePermascroll()
+	assert.True(std.legacy)
+	assert.Equal([]string{`a\tb`}, std.document)
+
+	AppendText(1, "\\")
+	Flush()
+	assert.Equal("+0I1,4:\\\n", mockFile.contents)
+
+	Init("I1,0:a\\tb\n")
+	assert.False(std.legacy)
+	assert.Equal([]string{"a\tb"}, std.document)
 
-	permascroll = []byte(magic + "S1,0\nI1,0:Test\n2I1,0:Two\n@3C1,0+3\n")
-	parsePermascroll()
-	assert.Equal(4, current)
-	assert.Equal([]cutType{{"Two", epoch.Add(3 * time.Minute)}}, cut)
-	assert.Equal([]string{"Two"}, document)
-	assert.Equal([]version{{0, 0, 3}, {8, 0, 2}, {13, 1, 0}, {23, 0, 4}, {33, 3, 0}}, history)
+	ReplaceText(1, 0, 3, "\t\\")
+	Flush()
+	assert.Contains(string(std.permascroll), "R1,0:a\\tb\t\\t\\\\\n")
+	Init(string(std.permascroll[len(magic):]))
+	assert.Equal([]string{"\t\\"}, std.document)
 }
 
 func TestParseTime(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
 
-	assert.Equal(time.Time{}, parseTime(""))
-	assert.Equal(epoch.Add(time.Millisecond), parseTime("+1"))
-	assert.Equal(epoch.Add(time.Minute), parseTime("@1"))
+	assert.Equal(time.Time{}, std.parseTime(""))
+	assert.Equal(epoch.Add(time.Millisecond), std.parseTime("+1"))
+	assert.Equal(epoch.Add(time.Minute), std.parseTime("@1"))
 
-	docCopy("Test", epoch.Add(time.Millisecond))
-	assert.Equal(epoch.Add(3*time.Millisecond), parseTime("+2"))
+	std.lastTime = epoch.Add(time.Millisecond)
+	assert.Equal(epoch.Add(3*time.Millisecond), std.parseTime("+2"))
 }
 
 func TestSplitParagraph(t *testing.T) {
@@ -504,38 +704,57 @@ func TestSplitParagraph(t *testing.T) {
 	for name, test := range tests {
 		t.Run(name, func(_ *testing.T) {
 			Init("")
-			document[0] = test.para
+			std.document[0] = test.para
 			SplitParagraph(1, test.pos)
-			assert.Equal(test.document, document)
+			assert.Equal(test.document, std.document)
 		})
 	}
 }
 
+func TestNewVersionCollision(t *testing.T) {
+	assert := assert.New(t)
+	p := New("I1,0:A\n")
+	p.file = &mockFileType{}
+	h := New("I1,0:B\n").hashDocument()
+	p.histHash[h] = []int{0} // The hash of "B" collides with that of version 0
+
+	p.ReplaceText(1, 0, 1, "B")
+	assert.Equal(2, p.CurrentVersion(), "new version rather than revisit")
+	assert.Equal([]int{0, 2}, p.histHash[h])
+	assert.Contains(string(p.permascroll), "R1,0:A\tB\n")
+
+	p.ReplaceText(1, 0, 1, "A")
+	assert.Equal(1, p.CurrentVersion(), "revisit")
+	p.ReplaceText(1, 0, 1, "B")
+	assert.Equal(2, p.CurrentVersion(), "revisit after collision")
+	assert.Len(p.history, 3)
+}
+
 func TestRedo(t *testing.T) {
 	assert := assert.New(t)
 
 	Init("")
 	Redo()
-	assert.Equal(0, current)
+	assert.Equal(0, std.current)
 
 	SplitParagraph(1, 0)
 	AppendText(1, "Test")
 	Undo()
 	Redo()
-	assert.Equal(2, current)
-	assert.Equal([]string{"Test", ""}, document)
+	assert.Equal(2, std.current)
+	assert.Equal([]string{"Test", ""}, std.document)
 
 	Redo()
-	assert.Equal(2, current)
+	assert.Equal(2, std.current)
 
 	Undo()
-	deleting = 1
+	std.deleting = 1
 	Redo()
-	assert.Equal(1, current)
+	assert.Equal(1, std.current)
 
-	deleting, pending = 0, "more"
+	std.deleting, std.pending = 0, "more"
 	Redo()
-	assert.Equal(1, current)
+	assert.Equal(1, std.current)
 
 	MergeParagraph(1)
 	CopyText(1, 2, 3)
@@ -548,32 +767,32 @@ func TestRedo(t *testing.T) {
 		Undo()
 	}
 	Redo()
-	assert.Equal(4, current)
-	assert.Equal([]string{"more"}, document)
+	assert.Equal(4, std.current)
+	assert.Equal([]string{"more"}, std.document)
 
 	Redo()
-	assert.Equal(5, current)
-	assert.Equal("r", cut[0].text)
+	assert.Equal(5, std.current)
+	assert.Equal("r", std.cut[0].text)
 
 	Redo()
-	assert.Equal(6, current)
-	assert.Equal([]string{"moe"}, document)
+	assert.Equal(6, std.current)
+	assert.Equal([]string{"moe"}, std.document)
 
 	Redo()
-	assert.Equal(7, current)
-	assert.Equal([]string{"mo", "e"}, document)
+	assert.Equal(7, std.current)
+	assert.Equal([]string{"mo", "e"}, std.document)
 
 	Redo()
-	assert.Equal(8, current)
-	assert.Equal("o", cut[1].text)
+	assert.Equal(8, std.current)
+	assert.Equal("o", std.cut[1].text)
 
 	Redo()
-	assert.Equal(9, current)
-	assert.Equal([]string{"e", "m"}, document)
+	assert.Equal(9, std.current)
+	assert.Equal([]string{"e", "m"}, std.document)
 
 	Redo()
-	assert.Equal(10, current)
-	assert.Equal([]string{"e", "nd"}, document)
+	assert.Equal(10, std.current)
+	assert.Equal([]string{"e", "nd"}, std.document)
 }
 
 func TestUndo(t *testing.T) {
@@ -581,70 +800,70 @@ func TestUndo(t *testing.T) {
 
 	Init("")
 	Undo()
-	assert.Equal(0, current)
+	assert.Equal(0, std.current)
 
 	SplitParagraph(1, 0)
 	AppendText(1, "Test")
 	MergeParagraph(1)
 	Undo()
-	assert.Equal(2, current)
-	assert.Equal([]string{"Test", ""}, document)
+	assert.Equal(2, std.current)
+	assert.Equal([]string{"Test", ""}, std.document)
 
-	docCopy("x", time.Now().Add(-3*time.Millisecond))
+	std.docCopy("x", time.Now().Add(-3*time.Millisecond))
 	CopyText(1, 1, 2)
 	Undo()
-	assert.Equal(2, current)
+	assert.Equal(2, std.current)
 
 	DeleteText(1, 1, 2)
 	Undo()
-	assert.Equal(2, current)
-	assert.Equal([]string{"Test", ""}, document)
-	expectHist := []version{{0, 0, 1}, {8, 0, 2}, {13, 1, 5}, {23, 2, 0}, {28, 2, 0}, {38, 2, 0}}
-	assert.Equal(expectHist, history)
-	expect := magic + "S1,0\nI1,0:Test\nM1,4\n1+3C1,1+1\n2D1,1:e\n"
-	assert.Equal(expect, string(permascroll))
+	assert.Equal(2, std.current)
+	assert.Equal([]string{"Test", ""}, std.document)
+	expectHist := []version{{0, 0, 1}, {8, 0, 2}, {15, 1, 5}, {27, 2, 0}, {34, 2, 0}, {44, 2, 0}}
+	assert.Equal(expectHist, std.history)
+	expect := magic + "+0S1,0\n+0I1,0:Test\n+0M1,4\n1+0C1,1+1\n2+0D1,1:e\n"
+	assert.Equal(expect, string(std.permascroll))
 
 	Undo()
-	assert.Equal(1, current)
+	assert.Equal(1, std.current)
 
 	SplitParagraph(1, 0)
 	Undo()
-	assert.Equal(1, current)
-	assert.Equal([]string{"", ""}, document)
-	expectHist = append(expectHist, version{46, 1, 0})
+	assert.Equal(1, std.current)
+	assert.Equal([]string{"", ""}, std.document)
+	expectHist = append(expectHist, version{54, 1, 0})
 	expectHist[1].lastChild = 6
-	assert.Equal(expectHist, history)
-	expect += "4S1,0\n"
-	assert.Equal(expect, string(permascroll))
+	assert.Equal(expectHist, std.history)
+	expect += "4+0S1,0\n"
+	assert.Equal(expect, string(std.permascroll))
 }
 
 func TestValidatePn(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
-	assert.PanicsWithError("paragraph '0' out of range", func() { validatePn(0) })
-	assert.NotPanics(func() { validatePn(1) })
-	assert.PanicsWithError("paragraph '2' out of range", func() { validatePn(2) })
+	assert.PanicsWithError("paragraph '0' out of range", func() { std.validatePn(0) })
+	assert.NotPanics(func() { std.validatePn(1) })
+	assert.PanicsWithError("paragraph '2' out of range", func() { std.validatePn(2) })
 }
 
 func TestValidatePos(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
-	assert.PanicsWithError("pos '1,-1' out of range", func() { validatePos(1, -1) })
-	assert.NotPanics(func() { validatePos(1, 0) })
-	assert.PanicsWithError("pos '1,1' out of range", func() { validatePos(1, 1) })
+	assert.PanicsWithError("pos '1,-1' out of range", func() { std.validatePos(1, -1) })
+	assert.NotPanics(func() { std.validatePos(1, 0) })
+	assert.PanicsWithError("pos '1,1' out of range", func() { std.validatePos(1, 1) })
 
 	InsertText(1, 0, "Test")
-	assert.NotPanics(func() { validatePos(1, 4) })
-	assert.PanicsWithError("pos '1,5' out of range", func() { validatePos(1, 5) })
+	assert.NotPanics(func() { std.validatePos(1, 4) })
+	assert.PanicsWithError("pos '1,5' out of range", func() { std.validatePos(1, 5) })
 }
 
 func TestValidateSpan(t *testing.T) {
 	assert := assert.New(t)
 	Init("")
-	assert.PanicsWithError("end '1,0-0' out of range", func() { validateSpan(1, 0, 0) })
-	assert.NotPanics(func() { validateSpan(1, 0, 1) })
+	assert.PanicsWithError("end '1,0-0' out of range", func() { std.validateSpan(1, 0, 0) })
+	assert.NotPanics(func() { std.validateSpan(1, 0, 1) })
 
 	InsertText(1, 0, "Test")
-	assert.NotPanics(func() { validateSpan(1, 4, 5) })
-	assert.PanicsWithError("end '1,4-6' out of range", func() { validateSpan(1, 4, 6) })
+	assert.NotPanics(func() { std.validateSpan(1, 4, 5) })
+	assert.PanicsWithError("end '1,4-6' out of range", func() { std.validateSpan(1, 4, 6) })
 }
@@ -0,0 +1,170 @@
+package permascroll
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+Implements the exchange of operations between the participants in a shared
+editing session.  One participant hosts the session and owns the permascroll,
+which records the operations of every participant in the order that the host
+applied them.  The other participants mirror the permascroll of the host and
+send their own operations to the host, which applies each of them to the version
+that it was performed on without changing its own current version.  Each
+participant therefore creates their own branches of the version tree and can
+adopt any version created by the others.
+
+A participant applies its own operations immediately, creating provisional
+versions beyond the mirrored permascroll.  The host normally appends exactly
+the same records, which then confirm the provisional versions.  If the host
+appends another record first, the provisional versions are discarded and
+replaced by the records of the host as they arrive.
+*/
+
+// An operation persisted to the permascroll, as reported to an observer.
+type Operation struct {
+	Version, Parent int       // Version created by the operation and the version it was applied to
+	Time            time.Time // When the operation was performed
+	Body            string    // Operation code and arguments
+	Record          string    // Record appended to the permascroll, including the undo delta and timestamp
+}
+
+// Discards everything written to it, for a mirror of the permascroll of a host.
+type discardFile struct{}
+
+func (discardFile) Close() error                      { return nil }
+func (discardFile) Sync() error                       { return nil }
+func (discardFile) Write(p []byte) (int, error)       { return len(p), nil }
+func (discardFile) WriteString(s string) (int, error) { return len(s), nil }
+
+/*
+Apply an operation performed by another participant to version parent and
+persist it, then return to the current version.  The body is the operation code
+and arguments as persisted, without an undo delta or timestamp.  Returns the
+version created, or the existing version if the operation revisits a previous
+state.
+*/
+func (ps *Permascroll) ApplyOperation(parent int, ts time.Time, body string) (v int, err error) {
+	if parent < 0 || parent >= len(ps.history) {
+		return -1, fmt.Errorf("failed to apply operation: version '%d' %w", parent, errRange)
+	}
+
+	if strings.Contains(body, "\n") {
+		return -1, fmt.Errorf("failed to apply operation: newline %w", errParse)
+	}
+
+	ps.Flush()
+	current, size := ps.current, len(ps.permascroll)
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				panic(r)
+			}
+
+			ps.permascroll, v, err = ps.permascroll[:size], -1, fmt.Errorf("failed to apply operation: %w", err)
+		}
+
+		ps.GotoVersion(current)
+	}()
+
+	ps.GotoVersion(parent)
+	ps.permascroll = append(ps.permascroll, body+"\n"...)
+	source := size
+	delta, op := ps.parseOperation(&source)
+	ps.permascroll = ps.permascroll[:size]
+	if delta > 0 || !op.ts.IsZero() {
+		panic(fmt.Errorf("operation %q %w", body, errParse))
+	}
+
+	ps.validateOperation(op)
+	op.ts, _ = ps.encodeTime(ts)
+	ps.docRedo(op)
+	ps.persist(ts, body)
+
+	return ps.current, nil
+}
+
+/*
+Append a record from the permascroll of the host to the mirror, discarding any
+provisional versions unless the record confirms the first of them.  A magic
+line starts the mirror again with an empty document.  The current version is
+retained, or its closest mirrored ancestor if it was discarded.  Returns the
+version created by the record.
+*/
+func (ps *Permascroll) MirrorRecord(record string) (v int, err error) {
+	if strings.HasPrefix(record, "Jotty") {
+		ps.Init("")
+		ps.permascroll = []byte(record)
+		if !ps.parseMagic() {
+			return -1, fmt.Errorf("failed to mirror permascroll: invalid magic, %w", errParse)
+		}
+		ps.mirrored = len(ps.permascroll)
+
+		return 0, nil
+	}
+
+	if !strings.HasSuffix(record, "\n") {
+		return -1, fmt.Errorf("failed to mirror permascroll: record %q %w", record, errParse)
+	}
+
+	ps.Flush()
+	if bytes.HasPrefix(ps.permascroll[ps.mirrored:], []byte(record)) {
+		v = ps.sourceVersion(ps.mirrored)
+		ps.mirrored += len(record)
+
+		return v, nil
+	}
+
+	current := ps.current
+	for ps.Provisional(current) {
+		current = ps.history[current].parent
+	}
+
+	if ps.mirrored < len(ps.permascroll) {
+		ps.replayGood(ps.mirrored)
+	}
+
+	source := len(ps.permascroll)
+	ps.permascroll = append(ps.permascroll, record...)
+	if bad := ps.tryReplay(source); bad >= 0 {
+		ps.replayGood(source)
+		ps.GotoVersion(current)
+
+		return -1, fmt.Errorf("failed to mirror permascroll: record %q %w", record, errParse)
+	}
+
+	ps.mirrored, v = len(ps.permascroll), len(ps.history)-1
+	ps.GotoVersion(current)
+
+	return v, nil
+}
+
+// Report every operation persisted to the permascroll to observe, or stop
+// reporting if it is nil.
+func (ps *Permascroll) Observe(observe func(Operation)) { ps.observe = observe }
+
+// Start an empty mirror of the permascroll of a host.  Nothing is written to a
+// file.
+func (ps *Permascroll) OpenMirror() {
+	ps.Init("")
+	ps.file, ps.path, ps.readOnly, ps.mirrored = discardFile{}, "", false, len(ps.permascroll)
+}
+
+// True if version v is a provisional version of a mirror, which has not yet
+// been confirmed by the host.
+func (ps *Permascroll) Provisional(v int) bool {
+	return ps.mirrored > 0 && ps.history[v].source >= ps.mirrored
+}
+
+// The records of the permascroll starting with the magic line, so that the
+// record at each index created the version with that number.
+func (ps *Permascroll) Records() []string {
+	ps.Flush()
+	records := strings.SplitAfter(string(ps.permascroll), "\n")
+
+	return records[:len(records)-1] // Omit the empty string after the last newline
+}
@@ -0,0 +1,110 @@
+package permascroll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOperation(t *testing.T) {
+	assert := assert.New(t)
+	p := New("I1,0:One\nI1,3: two\n")
+	p.file = &mockFileType{}
+	var ops []Operation
+	p.Observe(func(op Operation) { ops = append(ops, op) })
+
+	v, err := p.ApplyOperation(1, epoch.Add(time.Minute), "I1,3: three")
+	require.NoError(t, err)
+	assert.Equal(3, v)
+	assert.Equal(2, p.CurrentVersion(), "current version retained")
+	assert.Equal([]string{"One two"}, p.document)
+	assert.Equal([]Operation{{3, 1, epoch.Add(time.Minute), "I1,3: three", "1@1I1,3: three\n"}}, ops)
+	p.GotoVersion(3)
+	assert.Equal([]string{"One three"}, p.document)
+
+	v, err = p.ApplyOperation(2, epoch, "D1,3: two")
+	require.NoError(t, err)
+	assert.Equal(1, v, "revisited")
+	assert.Len(ops, 1)
+
+	_, err = p.ApplyOperation(4, epoch, "I1,0:X")
+	require.ErrorContains(t, err, "failed to apply operation: version '4' out of range")
+	_, err = p.ApplyOperation(1, epoch, "I1,9:X")
+	require.ErrorContains(t, err, "failed to apply operation: pos '1,9' out of range")
+	_, err = p.ApplyOperation(1, epoch, "2I1,0:X")
+	require.ErrorContains(t, err, "failed to apply operation: operation \"2I1,0:X\" parse failed")
+	_, err = p.ApplyOperation(1, epoch, "I1,0:X\nI1,0:Y")
+	require.ErrorContains(t, err, "failed to apply operation: newline parse failed")
+	assert.Equal(3, p.CurrentVersion())
+	assert.Equal(4, p.Versions())
+}
+
+func TestMirrorRecord(t *testing.T) {
+	assert := assert.New(t)
+	host := New("I1,0:One\n")
+	host.file = &mockFileType{}
+	var records []string
+	host.Observe(func(op Operation) { records = append(records, op.Record) })
+
+	mirror := New("")
+	mirror.OpenMirror()
+	var sent []Operation
+	mirror.Observe(func(op Operation) { sent = append(sent, op) })
+	for _, r := range host.Records() {
+		_, err := mirror.MirrorRecord(r)
+		require.NoError(t, err)
+	}
+	assert.Equal([]string{""}, mirror.document, "current version retained")
+	mirror.GotoVersion(1)
+	assert.Equal([]string{"One"}, mirror.document)
+	assert.Equal(2, mirror.Versions())
+
+	// The host appends the same record, confirming the provisional version
+	mirror.AppendText(1, " two")
+	mirror.Flush()
+	assert.True(mirror.Provisional(2))
+	_, err := host.ApplyOperation(sent[0].Parent, sent[0].Time, sent[0].Body)
+	require.NoError(t, err)
+	v, err := mirror.MirrorRecord(records[0])
+	require.NoError(t, err)
+	assert.Equal(2, v)
+	assert.False(mirror.Provisional(2))
+	assert.Equal(host.permascroll, mirror.permascroll)
+
+	// The host appends another record first, discarding the provisional version
+	mirror.AppendText(1, " three")
+	mirror.Flush()
+	host.AppendText(1, " four")
+	host.Flush()
+	_, err = host.ApplyOperation(sent[1].Parent, sent[1].Time, sent[1].Body)
+	require.NoError(t, err)
+	v, err = mirror.MirrorRecord(records[1])
+	require.NoError(t, err)
+	assert.Equal(3, v)
+	assert.Equal(2, mirror.CurrentVersion(), "provisional version discarded")
+	assert.Equal([]string{"One two"}, mirror.document)
+	v, err = mirror.MirrorRecord(records[2])
+	require.NoError(t, err)
+	assert.Equal(4, v)
+	assert.Equal(host.permascroll, mirror.permascroll)
+	mirror.GotoVersion(v)
+	assert.Equal([]string{"One two three"}, mirror.document)
+
+	_, err = mirror.MirrorRecord("I9,0:X\n")
+	require.ErrorContains(t, err, "failed to mirror permascroll: ")
+	assert.Equal(host.permascroll, mirror.permascroll)
+	_, err = mirror.MirrorRecord("I1,0:X")
+	require.ErrorContains(t, err, "failed to mirror permascroll: ")
+
+	_, err = mirror.MirrorRecord(magic)
+	require.NoError(t, err)
+	assert.Equal([]string{""}, mirror.document)
+	_, err = mirror.MirrorRecord("JottyVX\n")
+	require.ErrorContains(t, err, "failed to mirror permascroll: invalid magic")
+}
+
+func TestRecords(t *testing.T) {
+	assert.Equal(t, []string{magic, "I1,0:A\n", "S1,1\n"}, New("I1,0:A\nS1,1\n").Records())
+}
@@ -0,0 +1,286 @@
+package permascroll
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Implements transclusion, which inserts a reference to a span of earlier primedia
+rather than a copy of the characters.  The primedia of a version is the text
+inserted by its 'I' operation or the replacement text of its 'R' operation, and
+a transclusion records the permascroll offset of that operation together with
+the offset and size of the span within its text.
+
+The document keeps track of the position of each transclusion so that it can be
+displayed distinctly and its origin located.  Editing within transcluded text
+means that it no longer matches the primedia, so the transclusion is dropped.
+Dropped transclusions are retained with the version that dropped them so that
+undo can restore them.
+*/
+
+// Transclude arguments.
+var trRx = regexp.MustCompile(`^(\d+),(\d+):(\d+),(\d+)\+(\d+)\n`)
+
+// A span of transcluded text within a paragraph.
+type transclusion struct {
+	pn, begin, end int // Paragraph and byte offsets of the text in the document
+	origin, offset int // Permascroll offset of the operation and byte offset of the text within its primedia
+}
+
+// A span of transcluded text within a paragraph and the origin of its primedia.
+type Transclusion struct {
+	Begin, End int // Byte offsets of the text within the paragraph
+	Offset     int // Byte offset of the text within the primedia
+	Version    int // Version whose operation inserted the primedia
+}
+
+func (ps *Permascroll) docTransclude(op operation) {
+	ps.docInsert(op.text1)
+	ps.transclusions = append(ps.transclusions, transclusion{op.pn, op.offset1, ps.offset, op.offset2, op.size2})
+}
+
+// Parse the arguments of a transclude operation from the permascroll and
+// resolve the transcluded text from the primedia of its origin, if it is valid.
+func (ps *Permascroll) parseTransclusion(source *int) (op operation, match [][]byte) {
+	op.code = 'T'
+	match = trRx.FindSubmatch(ps.permascroll[*source:])
+	if match == nil {
+		return op, match
+	}
+
+	op.offset2, _ = strconv.Atoi(string(match[3]))
+	op.size2, _ = strconv.Atoi(string(match[4]))
+	op.size1, _ = strconv.Atoi(string(match[5]))
+	if op.offset2 < *source && ps.sourceVersion(op.offset2) >= 0 {
+		if text := ps.primedia(op.offset2); op.size1 > 0 && op.size2+op.size1 <= len(text) {
+			op.text1 = text[op.size2 : op.size2+op.size1]
+		}
+	}
+
+	return op, match
+}
+
+// Panic if the transcluded text cannot be resolved from the primedia of the
+// origin of a transclude operation.
+func (ps *Permascroll) validateOrigin(op operation) {
+	if ps.sourceVersion(op.offset2) < 0 {
+		panic(fmt.Errorf("origin '%d' %w", op.offset2, errRange))
+	}
+
+	if op.size1 <= 0 || op.size2+op.size1 > len(ps.primedia(op.offset2)) {
+		panic(fmt.Errorf("primedia '%d+%d' %w", op.size2, op.size1, errRange))
+	}
+}
+
+// The primedia of the operation at source in the permascroll, if any.
+func (ps *Permascroll) primedia(source int) string {
+	_, op := ps.parseOperation(&source)
+	switch op.code {
+	case 'I':
+		return op.text1
+	case 'R':
+		return op.text2
+	default:
+		return ""
+	}
+}
+
+// Versions whose operation inserted primedia within a single paragraph that can
+// be transcluded, oldest first.
+func (ps *Permascroll) Primedia() (v []int) {
+	if ps.legacy {
+		return v
+	}
+
+	ps.Flush()
+	for i := 1; i < len(ps.history); i++ {
+		if text := ps.primedia(ps.history[i].source); len(text) > 0 && !strings.Contains(text, "\n") {
+			v = append(v, i)
+		}
+	}
+
+	return v
+}
+
+// The version produced by the operation at source in the permascroll, or -1 if
+// there is none.
+func (ps *Permascroll) sourceVersion(source int) int {
+	v, found := slices.BinarySearchFunc(ps.history, source, func(v version, s int) int { return v.source - s })
+	if !found || v == 0 {
+		return -1
+	}
+
+	return v
+}
+
+// Transclude the primedia of version v between offset and end into a paragraph
+// at pos.
+func (ps *Permascroll) Transclude(pn, pos, v, offset, end int) {
+	ps.validatePos(pn, pos)
+	ps.validateVersion(v)
+	if ps.legacy {
+		panic(fmt.Errorf("transclusion %w", errLegacy))
+	}
+
+	ps.Flush()
+	origin := ps.history[v].source
+	text := ps.primedia(origin)
+	if offset < 0 || end <= offset || end > len(text) || strings.Contains(text[offset:end], "\n") {
+		panic(fmt.Errorf("primedia '%d-%d' %w", offset, end, errRange))
+	}
+
+	ps.paragraph, ps.offset = pn, pos
+	ps.docTransclude(operation{code: 'T', pn: pn, offset1: pos, offset2: origin, size2: offset, text1: text[offset:end]})
+	ps.persist(clock(), fmt.Sprintf("T%d,%d:%d,%d+%d", pn, pos, origin, offset, end-offset))
+}
+
+// The transcluded text within a paragraph in order of position, including the
+// effect of any pending insertion or deletion.
+func (ps *Permascroll) Transclusions(pn int) (t []Transclusion) {
+	ps.validatePn(pn)
+
+	trans := ps.transclusions
+	if pn == ps.paragraph && ps.deleting > 0 {
+		trans, _ = shiftDelete(trans, pn, ps.offset, pn, ps.offset+ps.deleting)
+	} else if pn == ps.paragraph && len(ps.pending) > 0 {
+		trans, _ = shiftInsert(trans, pn, ps.offset, pn, ps.offset+len(ps.pending))
+	}
+
+	for _, tr := range trans {
+		if tr.pn == pn {
+			t = append(t, Transclusion{tr.begin, tr.end, tr.offset, ps.sourceVersion(tr.origin)})
+		}
+	}
+	slices.SortFunc(t, func(a, b Transclusion) int { return a.Begin - b.Begin })
+
+	return t
+}
+
+// Serialisation of all transclusions in order of position for inclusion in the
+// hash of the document.
+func (ps *Permascroll) hashTransclusions() string {
+	trans := slices.Clone(ps.transclusions)
+	slices.SortFunc(trans, func(a, b transclusion) int { return cmp.Or(a.pn-b.pn, a.begin-b.begin) })
+
+	var b strings.Builder
+	for _, tr := range trans {
+		fmt.Fprintf(&b, "%d,%d-%d:%d,%d\n", tr.pn, tr.begin, tr.end, tr.origin, tr.offset)
+	}
+
+	return b.String()
+}
+
+// Adjust the transclusions for the deletion of the text between the current
+// position and end in paragraph epn, retaining any that are discarded.
+func (ps *Permascroll) deleteTransclusions(epn, end int) {
+	var dropped []transclusion
+	ps.transclusions, dropped = shiftDelete(ps.transclusions, ps.paragraph, ps.offset, epn, end)
+	ps.dropped = append(ps.dropped, dropped...)
+}
+
+// Adjust the transclusions for the insertion of text at the current position
+// that ends at end in paragraph epn, retaining any that are discarded.
+func (ps *Permascroll) insertTransclusions(epn, end int) {
+	var dropped []transclusion
+	ps.transclusions, dropped = shiftInsert(ps.transclusions, ps.paragraph, ps.offset, epn, end)
+	ps.dropped = append(ps.dropped, dropped...)
+}
+
+/*
+Adjust the transclusions for the deletion of the text between pos in paragraph
+pn and end in paragraph epn.  Transclusions overlapping the deleted text are
+dropped and those following it are moved.
+*/
+func shiftDelete(trans []transclusion, pn, pos, epn, end int) (kept, dropped []transclusion) {
+	for _, t := range trans {
+		switch {
+		case (t.pn > pn || (t.pn == pn && t.end > pos)) && (t.pn < epn || (t.pn == epn && t.begin < end)):
+			dropped = append(dropped, t)
+
+			continue
+		case t.pn == epn && t.begin >= end:
+			t.pn, t.begin, t.end = pn, t.begin-end+pos, t.end-end+pos
+		case t.pn > epn:
+			t.pn -= epn - pn
+		}
+
+		kept = append(kept, t)
+	}
+
+	return kept, dropped
+}
+
+/*
+Adjust the transclusions for the insertion of text at pos in paragraph pn that
+ends at end in paragraph epn.  Transclusions that the text is inserted within
+are dropped and those following it are moved.
+*/
+func shiftInsert(trans []transclusion, pn, pos, epn, end int) (kept, dropped []transclusion) {
+	for _, t := range trans {
+		switch {
+		case t.pn == pn && t.begin < pos && t.end > pos:
+			dropped = append(dropped, t)
+
+			continue
+		case t.pn == pn && t.begin >= pos:
+			t.pn, t.begin, t.end = epn, t.begin-pos+end, t.end-pos+end
+		case t.pn > pn:
+			t.pn += epn - pn
+		}
+
+		kept = append(kept, t)
+	}
+
+	return kept, dropped
+}
+
+// Adjust the transclusions for the exchange of two paragraphs or text spans in
+// the current paragraph.  Transclusions straddling the spans are dropped.
+func (ps *Permascroll) shiftExchange(first, second span) {
+	pn := ps.paragraph
+	if first.end == 0 {
+		for i := range ps.transclusions {
+			t := &ps.transclusions[i]
+			switch t.pn {
+			case pn - 1:
+				t.pn = pn
+			case pn:
+				t.pn = pn - 1
+			}
+		}
+
+		return
+	}
+
+	type move struct {
+		span
+		delta int
+	}
+	moves := []move{
+		{first, second.end - first.end},
+		{span{first.end, second.begin}, (second.end - second.begin) - (first.end - first.begin)},
+		{second, first.begin - second.begin},
+	}
+
+	var kept []transclusion
+	for _, t := range ps.transclusions {
+		if t.pn == pn && t.end > first.begin && t.begin < second.end {
+			i := slices.IndexFunc(moves, func(m move) bool { return t.begin >= m.begin && t.end <= m.end })
+			if i < 0 {
+				ps.dropped = append(ps.dropped, t)
+
+				continue
+			}
+
+			t.begin, t.end = t.begin+moves[i].delta, t.end+moves[i].delta
+		}
+
+		kept = append(kept, t)
+	}
+	ps.transclusions = kept
+}
@@ -0,0 +1,134 @@
+package permascroll
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrimedia(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One\nS1,3\nI2,0:A\\nB\nR1,0:O\tW\n")
+	assert.Equal([]int{1, 4}, Primedia())
+
+	std.legacy = true
+	assert.Nil(Primedia())
+	std.legacy = false
+}
+
+func TestTransclude(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One two\nS1,7\n")
+
+	assert.PanicsWithError("version '3' out of range", func() { Transclude(2, 0, 3, 0, 1) })
+	assert.PanicsWithError("primedia '0-1' out of range", func() { Transclude(2, 0, 2, 0, 1) })
+	assert.PanicsWithError("primedia '4-8' out of range", func() { Transclude(2, 0, 1, 4, 8) })
+
+	Transclude(2, 0, 1, 4, 7)
+	assert.Equal([]string{"One two", "two"}, std.document)
+	assert.Contains(string(std.permascroll), "+0T2,0:8,4+3\n")
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 4, Version: 1}}, Transclusions(2))
+	assert.Equal("two", GetVersion(3).Text)
+
+	InsertText(2, 0, "A ")
+	assert.Equal([]Transclusion{{Begin: 2, End: 5, Offset: 4, Version: 1}}, Transclusions(2), "pending insertion")
+	Flush()
+	assert.Equal([]Transclusion{{Begin: 2, End: 5, Offset: 4, Version: 1}}, Transclusions(2))
+
+	replayed := New(string(std.permascroll[len(magic):]))
+	assert.Equal(std.document, replayed.document)
+	assert.Equal(std.transclusions, replayed.transclusions)
+
+	DeleteText(2, 3, 4)
+	assert.Empty(Transclusions(2), "pending deletion")
+	Flush()
+	assert.Empty(Transclusions(2))
+
+	Undo()
+	Undo()
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 4, Version: 1}}, Transclusions(2))
+	Undo()
+	assert.Equal([]string{"One two", ""}, std.document)
+	assert.Empty(std.transclusions)
+
+	Redo()
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 4, Version: 1}}, Transclusions(2))
+
+	std.legacy = true
+	assert.PanicsWithError("transclusion unsupported by JottyV0", func() { Transclude(1, 0, 1, 0, 1) })
+	std.legacy = false
+}
+
+func TestTranscludeRevisit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.jot")
+
+	p := New("")
+	p.file = &mockFileType{}
+	p.InsertText(1, 0, "abc")
+	p.InsertText(1, 3, "abc")
+	p.Flush()
+	p.DeleteText(1, 3, 6)
+	p.Flush()
+
+	// The text matches the version before the deletion but the transclusion does not
+	p.Transclude(1, 3, 1, 0, 3)
+	want := []Transclusion{{Begin: 3, End: 6, Offset: 0, Version: 1}}
+	assert.Equal(t, want, p.Transclusions(1))
+	require.NoError(t, os.WriteFile(path, p.permascroll, 0o600))
+
+	q := New("")
+	require.NoError(t, q.OpenPermascroll(path))
+	assert.Equal(t, []string{"abcabc"}, q.document)
+	assert.Equal(t, want, q.Transclusions(1))
+	require.NoError(t, q.ClosePermascroll())
+}
+
+func TestParseTransclusion(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.PanicsWithError("origin '9' out of range", func() { Init("I1,0:AB\nT1,0:9,0+1\n") })
+	assert.PanicsWithError("origin '30' out of range", func() { Init("I1,0:AB\nT1,0:30,0+1\n") })
+	assert.PanicsWithError("primedia '1+2' out of range", func() { Init("I1,0:AB\nT1,0:8,1+2\n") })
+	assert.PanicsWithError("invalid arguments for 'T', parse failed", func() { Init("I1,0:AB\nT1,0:8\n") })
+}
+
+func TestShiftTransclusions(t *testing.T) {
+	assert := assert.New(t)
+	Init("I1,0:One two\nS1,3\nT2,4:8,4+3\nT1,0:8,0+3\n")
+	assert.Equal([]string{"OneOne", " twotwo"}, std.document)
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 0, Version: 1}}, Transclusions(1))
+
+	SplitParagraph(1, 3)
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 0, Version: 1}}, Transclusions(1))
+	assert.Empty(Transclusions(2))
+	assert.Equal([]Transclusion{{Begin: 4, End: 7, Offset: 4, Version: 1}}, Transclusions(3))
+
+	ExchangeParagraphs(3)
+	assert.Equal([]string{"One", " twotwo", "One"}, std.document)
+	assert.Equal([]Transclusion{{Begin: 4, End: 7, Offset: 4, Version: 1}}, Transclusions(2))
+
+	MergeParagraph(1)
+	assert.Equal([]string{"One twotwo", "One"}, std.document)
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 0, Version: 1}, {Begin: 7, End: 10, Offset: 4, Version: 1}},
+		Transclusions(1))
+
+	ExchangeText(1, 0, 3, 7, 10)
+	assert.Equal("two twoOne", GetText(1))
+	assert.Equal([]Transclusion{{Begin: 0, End: 3, Offset: 4, Version: 1}, {Begin: 7, End: 10, Offset: 0, Version: 1}},
+		Transclusions(1))
+
+	ExchangeText(1, 1, 2, 8, 9)
+	assert.Empty(Transclusions(1), "straddling")
+
+	Undo()
+	assert.Len(Transclusions(1), 2, "restored by undo")
+	Undo()
+	Undo()
+	assert.Equal([]Transclusion{{Begin: 4, End: 7, Offset: 4, Version: 1}}, Transclusions(2))
+
+	ReplaceText(2, 5, 6, "W")
+	assert.Empty(Transclusions(2))
+}